@@ -0,0 +1,139 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AWS calls accepted by AwsSdkCalls, named service:operation.
+const (
+	awsS3ListBuckets        = "s3:ListBuckets"
+	awsS3GetObject          = "s3:GetObject"
+	awsDynamoDBListTables   = "dynamodb:ListTables"
+	awsSqsListQueues        = "sqs:ListQueues"
+	awsStsGetCallerIdentity = "sts:GetCallerIdentity"
+)
+
+// Span attributes recording the retries of an AWS call.
+const (
+	awsRetryAttemptsAttributeKey = attribute.Key("aws.retry.attempts")
+	awsRetryErrorAttributeKey    = attribute.Key("aws.retry.error")
+)
+
+var awsSdkCalls = []string{awsS3ListBuckets, awsS3GetObject, awsDynamoDBListTables, awsSqsListQueues, awsStsGetCallerIdentity}
+
+// awsClient holds the AWS service clients used by /aws-sdk-call.
+type awsClient struct {
+	s3       *s3.Client
+	dynamodb *dynamodb.Client
+	sqs      *sqs.Client
+	sts      *sts.Client
+}
+
+// NewAwsClient creates the AWS service clients for cfg.AwsRegion, sending requests to cfg.AwsEndpoint instead of the AWS endpoints when it is set.
+// Every operation made by the clients is traced as a client span by the otelaws middleware.
+func NewAwsClient(ctx context.Context, cfg *Config) (*awsClient, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.AwsRegion))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AwsEndpoint != "" {
+		awsCfg.BaseEndpoint = aws.String(cfg.AwsEndpoint)
+	}
+	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
+	awsCfg.APIOptions = append(awsCfg.APIOptions, addRetryAttributes)
+
+	return &awsClient{
+		s3: s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			// Local stand-ins serve every bucket from the one endpoint
+			o.UsePathStyle = cfg.AwsEndpoint != ""
+		}),
+		dynamodb: dynamodb.NewFromConfig(awsCfg),
+		sqs:      sqs.NewFromConfig(awsCfg),
+		sts:      sts.NewFromConfig(awsCfg),
+	}, nil
+}
+
+// call makes the AWS call named by one of the AwsSdkCalls entries.
+func (c *awsClient) call(ctx context.Context, name string, cfg *Config) error {
+	switch name {
+	case awsS3ListBuckets:
+		_, err := c.s3.ListBuckets(ctx, &s3.ListBucketsInput{})
+		return err
+	case awsS3GetObject:
+		out, err := c.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(cfg.AwsS3Bucket), Key: aws.String(cfg.AwsS3Key)})
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, out.Body)
+		return out.Body.Close()
+	case awsDynamoDBListTables:
+		_, err := c.dynamodb.ListTables(ctx, &dynamodb.ListTablesInput{})
+		return err
+	case awsSqsListQueues:
+		_, err := c.sqs.ListQueues(ctx, &sqs.ListQueuesInput{})
+		return err
+	case awsStsGetCallerIdentity:
+		_, err := c.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	}
+	return fmt.Errorf("unsupported AWS call %q", name)
+}
+
+// callAll makes each of the AwsSdkCalls in turn and returns the failures joined together.
+func (c *awsClient) callAll(ctx context.Context, cfg *Config) error {
+	var errs []error
+	for _, name := range cfg.AwsSdkCalls {
+		if err := c.call(ctx, name, cfg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isAwsSdkCall reports whether name is one of the supported AWS calls.
+func isAwsSdkCall(name string) bool {
+	for _, call := range awsSdkCalls {
+		if name == call {
+			return true
+		}
+	}
+	return false
+}
+
+// addRetryAttributes adds a middleware recording the number of attempts made by an AWS operation, and the error of each retried attempt,
+// on the client span started by the otelaws middleware.
+func addRetryAttributes(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("GoSampleAppRetryAttributes", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+		out middleware.InitializeOutput, metadata middleware.Metadata, err error,
+	) {
+		out, metadata, err = next.HandleInitialize(ctx, in)
+		results, ok := retry.GetAttemptResults(metadata)
+		if !ok {
+			return out, metadata, err
+		}
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(awsRetryAttemptsAttributeKey.Int(len(results.Results)))
+		for _, result := range results.Results {
+			if result.Retried && result.Err != nil {
+				span.AddEvent("retry", trace.WithAttributes(awsRetryErrorAttributeKey.String(result.Err.Error())))
+			}
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
@@ -0,0 +1,54 @@
+package collection
+
+import (
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Values accepted by CardinalityMode.
+const (
+	cardinalityRotate = "rotate"
+	cardinalityRandom = "random"
+)
+
+// cardinality adds CardinalityAttributes extra attributes, each taking one of CardinalityValues values, to every recording
+// of the random and request metrics, so the number of metric streams can be raised to stress the collector and backends.
+type cardinality struct {
+	mu    sync.Mutex
+	next  map[string]int64
+	rands *lockedRands
+}
+
+// newCardinality returns a cardinality whose random values are drawn from the sequences given by seed and stream, one per instrument.
+func newCardinality(seed int64, stream int64) *cardinality {
+	return &cardinality{next: map[string]int64{}, rands: newLockedRands(seed, stream)}
+}
+
+// attributes returns labels followed by the extra attributes of the next recording of instrument. In rotate mode successive
+// recordings of the instrument go through every combination of values in turn, in random mode each attribute takes a random value.
+func (c *cardinality) attributes(cfg *Config, instrument string, labels []attribute.KeyValue) []attribute.KeyValue {
+	if cfg.CardinalityAttributes == 0 {
+		return labels
+	}
+	attrs := make([]attribute.KeyValue, 0, len(labels)+int(cfg.CardinalityAttributes))
+	attrs = append(attrs, labels...)
+
+	c.mu.Lock()
+	combination := c.next[instrument]
+	c.next[instrument]++
+	c.mu.Unlock()
+
+	for i := int64(0); i < cfg.CardinalityAttributes; i++ {
+		var value int64
+		if cfg.CardinalityMode == cardinalityRandom {
+			value = int64(c.rands.of(instrument).Intn(int(cfg.CardinalityValues)))
+		} else {
+			value = combination % cfg.CardinalityValues
+			combination /= cfg.CardinalityValues
+		}
+		attrs = append(attrs, attribute.String(fmt.Sprintf("attr_%d", i), fmt.Sprintf("value_%d", value)))
+	}
+	return attrs
+}
@@ -2,15 +2,14 @@ package collection
 
 import (
 	"context"
+	"errors"
+	"io"
 	"os"
-	"time"
+	"sync/atomic"
 
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/sdk/metric/aggregation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 
 	"go.opentelemetry.io/otel/sdk/metric"
@@ -18,7 +17,13 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-var cfg = GetConfiguration()
+// liveConfig is the configuration the client was started with, updated by WatchConfiguration when live settings change
+var liveConfig atomic.Pointer[Config]
+
+// currentConfig returns the configuration currently in effect.
+func currentConfig() *Config {
+	return liveConfig.Load()
+}
 
 const serviceName = "go"
 
@@ -34,6 +39,10 @@ const threadsActive = "threads_active"
 const totalBytesSent = "total_bytes_sent"
 const totalApiRequests = "total_api_requests"
 const latencyTime = "latency_time"
+const downstreamLatencyTime = "downstream_latency_time"
+
+// Suffix of the names of the Float64 counterparts of the instruments
+const floatSuffix = "_float"
 
 // Common attributes for traces and metrics (random, request)
 var requestMetricCommonLabels = []attribute.KeyValue{
@@ -48,19 +57,24 @@ var randomMetricCommonLabels = []attribute.KeyValue{
 	attribute.String("metricType", "random"),
 }
 
-var traceCommonLabels = []attribute.KeyValue{
-	attribute.String("signal", "trace"),
-	attribute.String("language", serviceName),
-	attribute.String("host", cfg.Host),
-	attribute.String("port", cfg.Port),
-}
+var traceCommonLabels []attribute.KeyValue
 
 // StartClient starts the traces and metrics providers which periodically collects signals and exports them.
-// Trace exporter and Metric exporter are both configured.
-func StartClient(ctx context.Context) (func(context.Context) error, error) {
+// Trace exporter and Metric exporter are both configured from cfg. The returned function flushes and shuts down
+// the providers within the deadline of its context, then closes the export files.
+func StartClient(ctx context.Context, cfg *Config) (func(context.Context) error, error) {
+	liveConfig.Store(cfg)
+	traceCommonLabels = []attribute.KeyValue{
+		attribute.String("signal", "trace"),
+		attribute.String("language", serviceName),
+		attribute.String("host", cfg.Host),
+		attribute.String("port", cfg.Port),
+	}
 
 	if id, present := os.LookupEnv("INSTANCE_ID"); present {
 		testingId = "_" + id
+		// Instruments named by the semantic conventions keep their name, so the id is also carried as an attribute
+		requestMetricCommonLabels = append(requestMetricCommonLabels, attribute.String("testingId", id))
 	}
 	res := resource.NewWithAttributes(
 		semconv.SchemaURL,
@@ -75,60 +89,90 @@ func StartClient(ctx context.Context) (func(context.Context) error, error) {
 	}
 
 	// Setup trace related
-	tp, err := setupTraceProvider(ctx, res)
+	tp, traceCloser, err := setupTraceProvider(ctx, cfg, res)
 	if err != nil {
 		return nil, err
 	}
 
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(xray.Propagator{}) // Set AWS X-Ray propagator
 
-	exp, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
+	// Set the configured propagators, AWS X-Ray by default
+	propagator, err := newPropagator(cfg)
 	if err != nil {
 		return nil, err
 	}
-	meterProvider := metric.NewMeterProvider(metric.WithResource(res), metric.WithReader(metric.NewPeriodicReader(exp)), metric.WithView(metric.NewView(
-		metric.Instrument{Name: "mp_histogram"},
-		metric.Stream{Aggregation: aggregation.ExplicitBucketHistogram{
-			Boundaries: []float64{100, 300, 500},
-		}},
-	)),)
+	otel.SetTextMapPropagator(propagator)
 
-	otel.SetMeterProvider(meterProvider)
+	exp, metricCloser, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	views, err := newViews(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := []metric.Option{metric.WithResource(res), metric.WithView(views...)}
+	// With the none exporter the meter provider has no reader, so metrics are recorded but never collected
+	if exp != nil {
+		opts = append(opts, metric.WithReader(metric.NewPeriodicReader(exp)))
+	}
+	meterProvider := metric.NewMeterProvider(opts...)
 
-	return func(context.Context) (err error) {
-		ctx, cancel := context.WithTimeout(ctx, time.Second)
-		defer cancel()
+	otel.SetMeterProvider(meterProvider)
 
+	return func(ctx context.Context) error {
 		// pushes any last exports to the receiver
-		err = meterProvider.Shutdown(ctx)
-		if err != nil {
-			return err
-		}
-		err = tp.Shutdown(ctx)
-		if err != nil {
-			return err
-		}
-		return nil
+		err := errors.Join(
+			meterProvider.ForceFlush(ctx),
+			tp.ForceFlush(ctx),
+		)
+		// The export files are closed even when the flush fails
+		return errors.Join(
+			err,
+			meterProvider.Shutdown(ctx),
+			tp.Shutdown(ctx),
+			closeAll(traceCloser, metricCloser),
+		)
 	}, nil
 }
 
-// setupTraceProvider configures a trace exporter and an AWS X-Ray ID Generator.
-func setupTraceProvider(ctx context.Context, res *resource.Resource) (*sdktrace.TracerProvider, error) {
-	// INSECURE !! NOT TO BE USED FOR ANYTHING IN PRODUCTION
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure())
+// setupTraceProvider configures a trace exporter, the configured sampler and an AWS X-Ray ID Generator.
+func setupTraceProvider(ctx context.Context, cfg *Config, res *resource.Resource) (*sdktrace.TracerProvider, io.Closer, error) {
+	traceExporter, closer, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	sampler, err := newSampler(ctx, cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	idg := xray.NewIDGenerator()
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(traceExporter),
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithResource(res),
 		sdktrace.WithIDGenerator(idg),
-	)
-	return tp, nil
-}
\ No newline at end of file
+	}
+	// With the none exporter spans are still sampled and propagated, but not exported
+	if traceExporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(traceExporter))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	return tp, closer, nil
+}
+
+// closeAll closes every non-nil closer and returns the first error encountered.
+func closeAll(closers ...io.Closer) error {
+	var err error
+	for _, c := range closers {
+		if c == nil {
+			continue
+		}
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
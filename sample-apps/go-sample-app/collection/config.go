@@ -1,38 +1,437 @@
 package collection
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // Config contains random based metrics; values inputed by configuration file or defaulted values
 type Config struct {
-	Host                    string   `mapstructure:"Host"`
-	Port                    string   `mapstructure:"Port"`
-	TimeInterval            int64    `mapstructure:"TimeInterval"`
-	TimeAliveIncrementer    int64    `mapstructure:"RandomTimeAliveIncrementer"`
-	TotalHeapSizeUpperBound int64    `mapstructure:"RandomTotalHeapSizeUpperBound"`
-	ThreadsActiveUpperBound int64    `mapstructure:"RandomThreadsActiveUpperBound"`
-	CpuUsageUpperBound      int64    `mapstructure:"RandomCpuUsageUpperBound"`
-	SampleAppPorts          []string `mapstructure:"SampleAppPorts"`
-}
-
-// GetConfiguration returns a configured Config struct with the precedence; Default Values < Configuration File.
-func GetConfiguration() *Config {
-	var arr []string
+	Host                             string                    `mapstructure:"Host"`
+	Port                             string                    `mapstructure:"Port"`
+	TimeInterval                     int64                     `mapstructure:"TimeInterval"`
+	TimeAliveIncrementer             int64                     `mapstructure:"RandomTimeAliveIncrementer"`
+	TotalHeapSizeUpperBound          int64                     `mapstructure:"RandomTotalHeapSizeUpperBound"`
+	ThreadsActiveUpperBound          int64                     `mapstructure:"RandomThreadsActiveUpperBound"`
+	CpuUsageUpperBound               int64                     `mapstructure:"RandomCpuUsageUpperBound"`
+	RandomGenerators                 map[string]ValueGenerator `mapstructure:"RandomGenerators"`
+	SampleAppPorts                   []SampleApp               `mapstructure:"SampleAppPorts"`
+	TracesExporter                   string                    `mapstructure:"TracesExporter"`
+	MetricsExporter                  string                    `mapstructure:"MetricsExporter"`
+	OtlpProtocol                     string                    `mapstructure:"OtlpProtocol"`
+	TracesExportFile                 string                    `mapstructure:"TracesExportFile"`
+	MetricsExportFile                string                    `mapstructure:"MetricsExportFile"`
+	ExporterHeaders                  map[string]string         `mapstructure:"ExporterHeaders"`
+	TlsEnabled                       bool                      `mapstructure:"TlsEnabled"`
+	TlsCaFile                        string                    `mapstructure:"TlsCaFile"`
+	TlsCertFile                      string                    `mapstructure:"TlsCertFile"`
+	TlsKeyFile                       string                    `mapstructure:"TlsKeyFile"`
+	TlsServerName                    string                    `mapstructure:"TlsServerName"`
+	TlsInsecureSkipVerify            bool                      `mapstructure:"TlsInsecureSkipVerify"`
+	TracesSampler                    string                    `mapstructure:"TracesSampler"`
+	TracesSamplerArg                 float64                   `mapstructure:"TracesSamplerArg"`
+	XraySamplerEndpoint              string                    `mapstructure:"XraySamplerEndpoint"`
+	XraySamplingRulesPollingInterval int64                     `mapstructure:"XraySamplingRulesPollingInterval"`
+	Propagators                      []string                  `mapstructure:"Propagators"`
+	ShutdownTimeout                  int64                     `mapstructure:"ShutdownTimeout"`
+	MetricsTemporality               string                    `mapstructure:"MetricsTemporality"`
+	MetricsSource                    string                    `mapstructure:"MetricsSource"`
+	FloatMetrics                     bool                      `mapstructure:"FloatMetrics"`
+	HttpSemconvMetrics               bool                      `mapstructure:"HttpSemconvMetrics"`
+	CardinalityAttributes            int64                     `mapstructure:"CardinalityAttributes"`
+	CardinalityValues                int64                     `mapstructure:"CardinalityValues"`
+	CardinalityMode                  string                    `mapstructure:"CardinalityMode"`
+	Seed                             int64                     `mapstructure:"Seed"`
+	ContribRuntimeMetrics            bool                      `mapstructure:"ContribRuntimeMetrics"`
+	ContribHostMetrics               bool                      `mapstructure:"ContribHostMetrics"`
+	MetricViews                      []MetricView              `mapstructure:"MetricViews"`
+	Metrics                          []MetricInstrument        `mapstructure:"Metrics"`
+	SampleAppFanOut                  string                    `mapstructure:"SampleAppFanOut"`
+	SampleAppMaxDepth                int64                     `mapstructure:"SampleAppMaxDepth"`
+	SampleAppTimeout                 int64                     `mapstructure:"SampleAppTimeout"`
+	LeafUrls                         []string                  `mapstructure:"LeafUrls"`
+	AwsSdkCalls                      []string                  `mapstructure:"AwsSdkCalls"`
+	AwsEndpoint                      string                    `mapstructure:"AwsEndpoint"`
+	AwsRegion                        string                    `mapstructure:"AwsRegion"`
+	AwsS3Bucket                      string                    `mapstructure:"AwsS3Bucket"`
+	AwsS3Key                         string                    `mapstructure:"AwsS3Key"`
+	LoadgenTarget                    string                    `mapstructure:"LoadgenTarget"`
+	LoadgenRps                       float64                   `mapstructure:"LoadgenRps"`
+	LoadgenMix                       map[string]int64          `mapstructure:"LoadgenMix"`
+	LoadgenRampUp                    int64                     `mapstructure:"LoadgenRampUp"`
+	LoadgenDuration                  int64                     `mapstructure:"LoadgenDuration"`
+	LoadgenConcurrency               int64                     `mapstructure:"LoadgenConcurrency"`
+	LoadgenTimeout                   int64                     `mapstructure:"LoadgenTimeout"`
+}
+
+// MetricView customizes the metric stream of the instruments matching InstrumentName
+type MetricView struct {
+	InstrumentName string    `mapstructure:"InstrumentName"`
+	Rename         string    `mapstructure:"Rename"`
+	Aggregation    string    `mapstructure:"Aggregation"`
+	Boundaries     []float64 `mapstructure:"Boundaries"`
+	MaxSize        int32     `mapstructure:"MaxSize"`
+	MaxScale       int32     `mapstructure:"MaxScale"`
+	AttributeKeys  []string  `mapstructure:"AttributeKeys"`
+}
+
+// SampleApp is a downstream sample app called by /outgoing-sampleapp. A plain string or number entry of SampleAppPorts
+// is decoded as its Port.
+type SampleApp struct {
+	Port    string `mapstructure:"Port"`    // URL, host:port pair or port on the local host
+	Timeout int64  `mapstructure:"Timeout"` // Time in seconds to wait for each call, SampleAppTimeout when 0
+}
+
+// configFlag is a command line flag overriding the configuration key of the same name.
+type configFlag struct {
+	name  string
+	key   string
+	kind  string
+	usage string
+}
+
+// configFlags are the configuration keys that can be overridden on the command line.
+var configFlags = []configFlag{
+	{"host", "Host", "string", "Host address to listen on"},
+	{"port", "Port", "string", "Port to listen on"},
+	{"time-interval", "TimeInterval", "int", "Time in seconds to generate new metrics"},
+	{"metrics-source", "MetricsSource", "string", "Source of the time_alive, cpu_usage, total_heap_size and threads_active values: random or runtime"},
+	{"float-metrics", "FloatMetrics", "bool", "Also report Float64 counterparts of the built-in instruments"},
+	{"http-semconv-metrics", "HttpSemconvMetrics", "bool", "Also report the HTTP server metrics of the semantic conventions"},
+	{"cardinality-attributes", "CardinalityAttributes", "int", "Number of extra attributes added to the random and request metrics"},
+	{"cardinality-values", "CardinalityValues", "int", "Number of distinct values of each extra attribute"},
+	{"cardinality-mode", "CardinalityMode", "string", "Values of the extra attributes: rotate or random"},
+	{"seed", "Seed", "int", "Seed of the random metric values, 0 to seed from the current time"},
+	{"contrib-runtime-metrics", "ContribRuntimeMetrics", "bool", "Also report the OpenTelemetry contrib Go runtime metrics"},
+	{"contrib-host-metrics", "ContribHostMetrics", "bool", "Also report the OpenTelemetry contrib host metrics"},
+	{"random-time-alive-incrementer", "RandomTimeAliveIncrementer", "int", "Amount to increment time_alive by every TimeInterval"},
+	{"random-total-heap-size-upper-bound", "RandomTotalHeapSizeUpperBound", "int", "Upper bound for random total_heap_size values"},
+	{"random-threads-active-upper-bound", "RandomThreadsActiveUpperBound", "int", "Upper bound for threads_active"},
+	{"random-cpu-usage-upper-bound", "RandomCpuUsageUpperBound", "int", "Upper bound for random cpu_usage values"},
+	{"sample-app-ports", "SampleAppPorts", "strings", "Sample app URLs, host:port pairs or local ports to make calls to"},
+	{"sample-app-fan-out", "SampleAppFanOut", "string", "Call sample apps one after another (sequential) or all at once (parallel)"},
+	{"sample-app-max-depth", "SampleAppMaxDepth", "int", "Maximum number of sample app hops in a call chain"},
+	{"sample-app-timeout", "SampleAppTimeout", "int", "Time in seconds to wait for each sample app call"},
+	{"leaf-urls", "LeafUrls", "strings", "URLs called by /outgoing-http-call and leaf sample apps, local for the built-in echo endpoint"},
+	{"aws-sdk-calls", "AwsSdkCalls", "strings", "AWS calls made by /aws-sdk-call, e.g. s3:ListBuckets or sts:GetCallerIdentity"},
+	{"aws-endpoint", "AwsEndpoint", "string", "Endpoint URL of a local AWS stand-in used instead of the AWS endpoints"},
+	{"aws-region", "AwsRegion", "string", "AWS region used for the AWS calls"},
+	{"aws-s3-bucket", "AwsS3Bucket", "string", "Bucket read by the s3:GetObject call"},
+	{"aws-s3-key", "AwsS3Key", "string", "Object key read by the s3:GetObject call"},
+	{"loadgen-target", "LoadgenTarget", "string", "URL of the sample app the loadgen subcommand calls"},
+	{"loadgen-rps", "LoadgenRps", "float", "Requests per second made by the loadgen subcommand"},
+	{"loadgen-mix", "LoadgenMix", "map", "Endpoints called by the loadgen subcommand and their weights, e.g. /aws-sdk-call=1,/outgoing-http-call=3"},
+	{"loadgen-ramp-up", "LoadgenRampUp", "int", "Time in seconds the loadgen subcommand takes to reach LoadgenRps"},
+	{"loadgen-duration", "LoadgenDuration", "int", "Time in seconds the loadgen subcommand runs for, 0 to run until interrupted"},
+	{"loadgen-concurrency", "LoadgenConcurrency", "int", "Maximum number of requests in flight from the loadgen subcommand"},
+	{"loadgen-timeout", "LoadgenTimeout", "int", "Time in seconds the loadgen subcommand waits for each request"},
+	{"traces-exporter", "TracesExporter", "string", "Traces exporter: otlp, stdout, file or none"},
+	{"metrics-exporter", "MetricsExporter", "string", "Metrics exporter: otlp, stdout, file or none"},
+	{"otlp-protocol", "OtlpProtocol", "string", "OTLP protocol: grpc or http/protobuf"},
+	{"traces-export-file", "TracesExportFile", "string", "File spans are appended to by the file exporter"},
+	{"metrics-export-file", "MetricsExportFile", "string", "File metrics are appended to by the file exporter"},
+	{"tls-enabled", "TlsEnabled", "bool", "Use TLS for the OTLP exporters"},
+	{"tls-ca-file", "TlsCaFile", "string", "CA bundle used to verify the collector"},
+	{"tls-cert-file", "TlsCertFile", "string", "Client certificate for mutual TLS"},
+	{"tls-key-file", "TlsKeyFile", "string", "Client key for mutual TLS"},
+	{"tls-server-name", "TlsServerName", "string", "Server name used to verify the collector certificate"},
+	{"tls-insecure-skip-verify", "TlsInsecureSkipVerify", "bool", "Skip verification of the collector certificate"},
+	{"traces-sampler", "TracesSampler", "string", "Traces sampler"},
+	{"traces-sampler-arg", "TracesSamplerArg", "float", "Sampling ratio for the traceidratio samplers"},
+	{"xray-sampler-endpoint", "XraySamplerEndpoint", "string", "Endpoint X-Ray sampling rules are polled from"},
+	{"xray-sampling-rules-polling-interval", "XraySamplingRulesPollingInterval", "int", "Time in seconds between polls for X-Ray sampling rules"},
+	{"propagators", "Propagators", "strings", "Propagators: tracecontext, baggage, b3, b3multi, xray or none"},
+	{"shutdown-timeout", "ShutdownTimeout", "int", "Time in seconds to drain requests and flush signals on shutdown"},
+	{"metrics-temporality", "MetricsTemporality", "string", "Metrics temporality: cumulative, delta or lowmemory"},
+}
+
+// GetConfiguration returns a configured Config struct with the precedence;
+// Default Values < Configuration File < OTEL_* Environment Variables < SAMPLEAPP_* Environment Variables < Command Line Flags.
+// The configuration file is config.yaml in the working directory unless --config is given.
+// An error is returned if the configuration file cannot be parsed or a value is invalid.
+func GetConfiguration(args []string) (*Config, error) {
+	var arr []SampleApp
 	viper.SetDefault("Host", "0.0.0.0")
 	viper.SetDefault("Port", "8080")
 	viper.SetDefault("TimeInterval", 1)
+	viper.SetDefault("MetricsSource", "random")
+	viper.SetDefault("FloatMetrics", false)
+	viper.SetDefault("HttpSemconvMetrics", false)
+	viper.SetDefault("CardinalityAttributes", 0)
+	viper.SetDefault("CardinalityValues", 10)
+	viper.SetDefault("CardinalityMode", "rotate")
+	viper.SetDefault("Seed", 0)
+	viper.SetDefault("ContribRuntimeMetrics", false)
+	viper.SetDefault("ContribHostMetrics", false)
 	viper.SetDefault("RandomTimeAliveIncrementer", 1)
 	viper.SetDefault("RandomTotalHeapSizeUpperBound", 100)
 	viper.SetDefault("RandomThreadsActiveUpperBound", 10)
 	viper.SetDefault("RandomCpuUsageUpperBound", 100)
+	viper.SetDefault("RandomGenerators", map[string]interface{}{})
 	viper.SetDefault("SampleAppPorts", arr)
+	viper.SetDefault("SampleAppFanOut", "sequential")
+	viper.SetDefault("SampleAppMaxDepth", 10)
+	viper.SetDefault("SampleAppTimeout", 5)
+	viper.SetDefault("LeafUrls", []string{"https://aws.amazon.com"})
+	viper.SetDefault("AwsSdkCalls", []string{"s3:ListBuckets"})
+	viper.SetDefault("AwsEndpoint", "")
+	viper.SetDefault("AwsRegion", "us-west-2")
+	viper.SetDefault("AwsS3Bucket", "go-sample-app")
+	viper.SetDefault("AwsS3Key", "sample.txt")
+	viper.SetDefault("LoadgenTarget", "http://localhost:8080")
+	viper.SetDefault("LoadgenRps", 10.0)
+	viper.SetDefault("LoadgenMix", map[string]interface{}{})
+	viper.SetDefault("LoadgenRampUp", 0)
+	viper.SetDefault("LoadgenDuration", 60)
+	viper.SetDefault("LoadgenConcurrency", 10)
+	viper.SetDefault("LoadgenTimeout", 10)
+	viper.SetDefault("TracesExporter", "otlp")
+	viper.SetDefault("MetricsExporter", "otlp")
+	viper.SetDefault("OtlpProtocol", "grpc")
+	viper.SetDefault("TracesExportFile", "traces.jsonl")
+	viper.SetDefault("MetricsExportFile", "metrics.jsonl")
+	viper.SetDefault("TlsEnabled", false)
+	viper.SetDefault("TlsCaFile", "")
+	viper.SetDefault("TlsCertFile", "")
+	viper.SetDefault("TlsKeyFile", "")
+	viper.SetDefault("TlsServerName", "")
+	viper.SetDefault("TlsInsecureSkipVerify", false)
+	viper.SetDefault("TracesSampler", "always_on")
+	viper.SetDefault("TracesSamplerArg", 1.0)
+	viper.SetDefault("XraySamplerEndpoint", "http://localhost:2000")
+	viper.SetDefault("XraySamplingRulesPollingInterval", 300)
+	viper.SetDefault("Propagators", []string{"xray"})
+	viper.SetDefault("ShutdownTimeout", 5)
+	viper.SetDefault("MetricsTemporality", "cumulative")
+	viper.SetDefault("Metrics", []map[string]interface{}{})
+	viper.SetDefault("MetricViews", []map[string]interface{}{
+		{"InstrumentName": latencyTime + "*", "Aggregation": "explicit_bucket_histogram", "Boundaries": []float64{100, 300, 500}},
+	})
 
-	viper.SetConfigFile("config.yaml")
-	viper.ReadInConfig()
+	// Exporter, sampler, propagator and temporality selection follow the OpenTelemetry SDK environment variables when they are set,
+	// and the AWS region follows AWS_REGION.
+	viper.BindEnv("TracesExporter", "OTEL_TRACES_EXPORTER")
+	viper.BindEnv("MetricsExporter", "OTEL_METRICS_EXPORTER")
+	viper.BindEnv("OtlpProtocol", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	viper.BindEnv("TracesSampler", "OTEL_TRACES_SAMPLER")
+	viper.BindEnv("TracesSamplerArg", "OTEL_TRACES_SAMPLER_ARG")
+	viper.BindEnv("Propagators", "OTEL_PROPAGATORS")
+	viper.BindEnv("MetricsTemporality", "OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE")
+	viper.BindEnv("AwsRegion", "AWS_REGION")
 
+	// Every key can be overridden with its upper cased name prefixed by SAMPLEAPP_, e.g. SAMPLEAPP_PORT.
+	viper.SetEnvPrefix("SAMPLEAPP")
+	viper.AutomaticEnv()
+
+	flags := pflag.NewFlagSet("go-sample-app", pflag.ExitOnError)
+	configFile := flags.String("config", "config.yaml", "Path to the configuration file")
+	for _, f := range configFlags {
+		switch f.kind {
+		case "int":
+			flags.Int64(f.name, 0, f.usage)
+		case "float":
+			flags.Float64(f.name, 0, f.usage)
+		case "bool":
+			flags.Bool(f.name, false, f.usage)
+		case "strings":
+			flags.StringSlice(f.name, nil, f.usage)
+		case "map":
+			flags.StringToInt(f.name, nil, f.usage)
+		default:
+			flags.String(f.name, "", f.usage)
+		}
+		// Only flags set on the command line take precedence over the other sources.
+		viper.BindPFlag(f.key, flags.Lookup(f.name))
+	}
+	flags.Parse(args)
+
+	viper.SetConfigFile(*configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		// The default configuration file is optional, an explicitly given one is not.
+		if !errors.Is(err, os.ErrNotExist) || flags.Changed("config") {
+			return nil, fmt.Errorf("reading configuration file %s: %w", *configFile, err)
+		}
+	}
+
+	return unmarshalConfiguration()
+}
+
+// ReloadConfiguration re-reads the configuration file given to GetConfiguration and returns the resulting Config,
+// keeping the environment variable and command line overrides.
+func ReloadConfiguration() (*Config, error) {
+	if err := viper.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading configuration file %s: %w", viper.ConfigFileUsed(), err)
+	}
+	return unmarshalConfiguration()
+}
+
+// unmarshalConfiguration decodes and validates the configuration read by viper.
+func unmarshalConfiguration() (*Config, error) {
 	cfg := &Config{}
-	viper.Unmarshal(cfg)
+	// The default decode hooks of viper are kept, and plain SampleAppPorts entries become SampleApps
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		sampleAppHook,
+	))
+	if err := viper.Unmarshal(cfg, decodeHook); err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// sampleAppHook decodes a SampleAppPorts entry given as a string or a number, e.g. on the command line, into a SampleApp.
+func sampleAppHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(SampleApp{}) {
+		return data, nil
+	}
+	switch data.(type) {
+	case string, int, int64, uint64, float64:
+		return SampleApp{Port: fmt.Sprint(data)}, nil
+	}
+	return data, nil
+}
 
-	return cfg
+// validate checks the values that would otherwise fail or panic once the application is running.
+func (cfg *Config) validate() error {
+	if cfg.Port == "" {
+		return errors.New("Port must be set")
+	}
+	if cfg.TimeInterval <= 0 {
+		return fmt.Errorf("TimeInterval must be greater than 0, got %d", cfg.TimeInterval)
+	}
+	if cfg.MetricsSource != metricsSourceRandom && cfg.MetricsSource != metricsSourceRuntime {
+		return fmt.Errorf("MetricsSource must be random or runtime, got %q", cfg.MetricsSource)
+	}
+	if cfg.TimeAliveIncrementer < 0 {
+		return fmt.Errorf("RandomTimeAliveIncrementer must not be negative, got %d", cfg.TimeAliveIncrementer)
+	}
+	if cfg.TotalHeapSizeUpperBound <= 0 {
+		return fmt.Errorf("RandomTotalHeapSizeUpperBound must be greater than 0, got %d", cfg.TotalHeapSizeUpperBound)
+	}
+	if cfg.ThreadsActiveUpperBound < 0 {
+		return fmt.Errorf("RandomThreadsActiveUpperBound must not be negative, got %d", cfg.ThreadsActiveUpperBound)
+	}
+	if cfg.CpuUsageUpperBound <= 0 {
+		return fmt.Errorf("RandomCpuUsageUpperBound must be greater than 0, got %d", cfg.CpuUsageUpperBound)
+	}
+	if cfg.CardinalityAttributes < 0 {
+		return fmt.Errorf("CardinalityAttributes must not be negative, got %d", cfg.CardinalityAttributes)
+	}
+	if cfg.CardinalityValues <= 0 {
+		return fmt.Errorf("CardinalityValues must be greater than 0, got %d", cfg.CardinalityValues)
+	}
+	if cfg.CardinalityMode != cardinalityRotate && cfg.CardinalityMode != cardinalityRandom {
+		return fmt.Errorf("CardinalityMode must be rotate or random, got %q", cfg.CardinalityMode)
+	}
+	for name, g := range cfg.RandomGenerators {
+		if !isGeneratorInstrument(name) {
+			return fmt.Errorf("RandomGenerators can only be set for %v, got %q", generatorInstruments, name)
+		}
+		if err := g.validate(name); err != nil {
+			return err
+		}
+		// The upper bound of threads_active may otherwise be 0, which leaves nothing for its generator to produce
+		if name == threadsActive && cfg.ThreadsActiveUpperBound <= 0 {
+			return fmt.Errorf("RandomThreadsActiveUpperBound must be greater than 0 when threads_active has a generator, got %d", cfg.ThreadsActiveUpperBound)
+		}
+	}
+	metricNames := map[string]bool{}
+	for _, mi := range cfg.Metrics {
+		if err := mi.validate(); err != nil {
+			return err
+		}
+		if metricNames[mi.Name] {
+			return fmt.Errorf("Metrics %s: declared more than once", mi.Name)
+		}
+		metricNames[mi.Name] = true
+	}
+	for _, app := range cfg.SampleAppPorts {
+		if app.Port == "" {
+			return errors.New("SampleAppPorts entries must have a Port")
+		}
+		if _, err := sampleAppURL(app.Port); err != nil {
+			return err
+		}
+		if app.Timeout < 0 {
+			return fmt.Errorf("SampleAppPorts Timeout of %s must not be negative, got %d", app.Port, app.Timeout)
+		}
+	}
+	for _, entry := range cfg.LeafUrls {
+		if entry == localLeaf {
+			continue
+		}
+		if u, err := url.Parse(entry); err != nil || u.Host == "" {
+			return fmt.Errorf("LeafUrls must contain absolute URLs or local, got %q", entry)
+		}
+	}
+	for _, call := range cfg.AwsSdkCalls {
+		if !isAwsSdkCall(call) {
+			return fmt.Errorf("AwsSdkCalls must contain %s, got %q", strings.Join(awsSdkCalls, ", "), call)
+		}
+	}
+	if cfg.AwsEndpoint != "" {
+		if u, err := url.Parse(cfg.AwsEndpoint); err != nil || u.Host == "" {
+			return fmt.Errorf("AwsEndpoint must be an absolute URL, got %q", cfg.AwsEndpoint)
+		}
+	}
+	if u, err := url.Parse(cfg.LoadgenTarget); err != nil || u.Host == "" {
+		return fmt.Errorf("LoadgenTarget must be an absolute URL, got %q", cfg.LoadgenTarget)
+	}
+	if cfg.LoadgenRps <= 0 {
+		return fmt.Errorf("LoadgenRps must be greater than 0, got %g", cfg.LoadgenRps)
+	}
+	var weights int64
+	for endpoint, weight := range cfg.LoadgenMix {
+		if !strings.HasPrefix(endpoint, "/") {
+			return fmt.Errorf("LoadgenMix endpoints must start with /, got %q", endpoint)
+		}
+		if weight < 0 {
+			return fmt.Errorf("LoadgenMix weight of %s must not be negative, got %d", endpoint, weight)
+		}
+		weights += weight
+	}
+	if len(cfg.LoadgenMix) > 0 && weights == 0 {
+		return errors.New("LoadgenMix must give at least one endpoint a weight greater than 0")
+	}
+	if cfg.LoadgenRampUp < 0 || cfg.LoadgenDuration < 0 {
+		return fmt.Errorf("LoadgenRampUp and LoadgenDuration must not be negative, got %d and %d", cfg.LoadgenRampUp, cfg.LoadgenDuration)
+	}
+	if cfg.LoadgenConcurrency <= 0 {
+		return fmt.Errorf("LoadgenConcurrency must be greater than 0, got %d", cfg.LoadgenConcurrency)
+	}
+	if cfg.LoadgenTimeout <= 0 {
+		return fmt.Errorf("LoadgenTimeout must be greater than 0, got %d", cfg.LoadgenTimeout)
+	}
+	if cfg.SampleAppFanOut != fanOutSequential && cfg.SampleAppFanOut != fanOutParallel {
+		return fmt.Errorf("SampleAppFanOut must be sequential or parallel, got %q", cfg.SampleAppFanOut)
+	}
+	if cfg.SampleAppMaxDepth <= 0 {
+		return fmt.Errorf("SampleAppMaxDepth must be greater than 0, got %d", cfg.SampleAppMaxDepth)
+	}
+	if cfg.SampleAppTimeout <= 0 {
+		return fmt.Errorf("SampleAppTimeout must be greater than 0, got %d", cfg.SampleAppTimeout)
+	}
+	if cfg.TracesSamplerArg < 0 || cfg.TracesSamplerArg > 1 {
+		return fmt.Errorf("TracesSamplerArg must be between 0 and 1, got %g", cfg.TracesSamplerArg)
+	}
+	if cfg.XraySamplingRulesPollingInterval <= 0 {
+		return fmt.Errorf("XraySamplingRulesPollingInterval must be greater than 0, got %d", cfg.XraySamplingRulesPollingInterval)
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return fmt.Errorf("ShutdownTimeout must be greater than 0, got %d", cfg.ShutdownTimeout)
+	}
+	return nil
 }
@@ -0,0 +1,307 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Kinds accepted by the Kind of a MetricInstrument.
+const (
+	kindCounter                 = "counter"
+	kindUpDownCounter           = "updowncounter"
+	kindHistogram               = "histogram"
+	kindGauge                   = "gauge"
+	kindObservableCounter       = "observable_counter"
+	kindObservableUpDownCounter = "observable_updowncounter"
+	kindObservableGauge         = "observable_gauge"
+)
+
+// Value types accepted by the ValueType of a MetricInstrument.
+const (
+	valueTypeInt   = "int"
+	valueTypeFloat = "float"
+)
+
+// Upper bound of the values of a MetricInstrument which does not set one.
+const defaultUpperBound = 100
+
+// MetricInstrument declares an additional instrument created from the Metrics section of the configuration.
+// Its values are produced by Generator between 0 and UpperBound and recorded once per attribute set in Attributes.
+// Each attribute set is a list of key=value strings rather than a map, as the configuration parser lower cases map keys.
+type MetricInstrument struct {
+	Name        string         `mapstructure:"Name"`
+	Kind        string         `mapstructure:"Kind"`
+	ValueType   string         `mapstructure:"ValueType"`
+	Unit        string         `mapstructure:"Unit"`
+	Description string         `mapstructure:"Description"`
+	UpperBound  float64        `mapstructure:"UpperBound"`
+	Generator   ValueGenerator `mapstructure:"Generator"`
+	Attributes  [][]string     `mapstructure:"Attributes"`
+}
+
+var customMetricCommonLabels = []attribute.KeyValue{
+	attribute.String("signal", "metric"),
+	attribute.String("language", serviceName),
+	attribute.String("metricType", "custom"),
+}
+
+// fixedInstruments are the names of the instruments the application always creates.
+var fixedInstruments = []string{timeAlive, cpuUsage, totalHeapSize, threadsActive, totalBytesSent, totalApiRequests, latencyTime}
+
+// validate checks the declaration of the instrument.
+func (mi MetricInstrument) validate() error {
+	if mi.Name == "" {
+		return fmt.Errorf("Metrics must have a Name")
+	}
+	for _, name := range fixedInstruments {
+		if mi.Name == name || mi.Name == name+floatSuffix {
+			return fmt.Errorf("Metrics %s: the name is used by a built-in instrument", mi.Name)
+		}
+	}
+	switch mi.Kind {
+	case kindCounter, kindUpDownCounter, kindHistogram, kindGauge, kindObservableCounter, kindObservableUpDownCounter, kindObservableGauge:
+	default:
+		return fmt.Errorf("Metrics %s: unsupported kind %q", mi.Name, mi.Kind)
+	}
+	if mi.ValueType != "" && mi.ValueType != valueTypeInt && mi.ValueType != valueTypeFloat {
+		return fmt.Errorf("Metrics %s: ValueType must be int or float, got %q", mi.Name, mi.ValueType)
+	}
+	if mi.UpperBound < 0 {
+		return fmt.Errorf("Metrics %s: UpperBound must not be negative, got %g", mi.Name, mi.UpperBound)
+	}
+	if mi.ValueType != valueTypeFloat && mi.UpperBound > 0 && mi.UpperBound < 1 {
+		return fmt.Errorf("Metrics %s: UpperBound of an int instrument must be at least 1, got %g", mi.Name, mi.UpperBound)
+	}
+	for _, set := range mi.Attributes {
+		keys := map[string]bool{}
+		for _, entry := range set {
+			key, _, ok := strings.Cut(entry, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("Metrics %s: attribute %q must be key=value", mi.Name, entry)
+			}
+			if keys[key] {
+				return fmt.Errorf("Metrics %s: attribute %s set more than once in an attribute set", mi.Name, key)
+			}
+			keys[key] = true
+		}
+	}
+	return mi.Generator.validate(mi.Name)
+}
+
+// customInstrument is a created MetricInstrument.
+type customInstrument struct {
+	spec       MetricInstrument
+	upperBound float64
+	sets       []metric.MeasurementOption
+	// last holds the level of an up down counter, or the total of an observable counter, for each attribute set
+	last   []float64
+	record func(ctx context.Context, set int, value float64)
+}
+
+// customMetricCollector contains the instruments declared in the Metrics section of the configuration.
+type customMetricCollector struct {
+	instruments []*customInstrument
+	meter       metric.Meter
+	generators  *generators
+}
+
+// NewCustomMetricCollector returns a new type struct that holds and registers the instruments declared in the Metrics section of the configuration.
+func NewCustomMetricCollector(mp metric.MeterProvider) customMetricCollector {
+	cfg := currentConfig()
+	cmc := customMetricCollector{generators: newGenerators(cfg.Seed, customMetricsStream)}
+	cmc.meter = mp.Meter("github.com/aws-otel-commnunity/sample-apps/go-sample-app/collection")
+	for _, spec := range cfg.Metrics {
+		ci, err := cmc.register(spec)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		cmc.instruments = append(cmc.instruments, ci)
+	}
+	return cmc
+}
+
+// register creates the instrument declared by spec. Synchronous instruments are recorded by RegisterMetricsClient,
+// observable instruments every SDK call. A gauge is observable as the metrics API has no synchronous gauge.
+func (cmc *customMetricCollector) register(spec MetricInstrument) (*customInstrument, error) {
+	ci := &customInstrument{spec: spec, upperBound: spec.UpperBound, sets: attributeSets(spec.Attributes)}
+	if ci.upperBound == 0 {
+		ci.upperBound = defaultUpperBound
+	}
+	ci.last = make([]float64, len(ci.sets))
+	name := spec.Name + testingId
+	unit := metric.WithUnit(spec.Unit)
+	description := metric.WithDescription(spec.Description)
+
+	if spec.ValueType == valueTypeFloat {
+		switch spec.Kind {
+		case kindCounter:
+			c, err := cmc.meter.Float64Counter(name, unit, description)
+			if err != nil {
+				return nil, err
+			}
+			ci.record = func(ctx context.Context, set int, value float64) {
+				c.Add(ctx, value, ci.sets[set])
+			}
+		case kindUpDownCounter:
+			c, err := cmc.meter.Float64UpDownCounter(name, unit, description)
+			if err != nil {
+				return nil, err
+			}
+			ci.record = func(ctx context.Context, set int, value float64) {
+				c.Add(ctx, value-ci.last[set], ci.sets[set])
+				ci.last[set] = value
+			}
+		case kindHistogram:
+			h, err := cmc.meter.Float64Histogram(name, unit, description)
+			if err != nil {
+				return nil, err
+			}
+			ci.record = func(ctx context.Context, set int, value float64) {
+				h.Record(ctx, value, ci.sets[set])
+			}
+		case kindObservableCounter:
+			_, err := cmc.meter.Float64ObservableCounter(name, unit, description, metric.WithFloat64Callback(
+				func(ctx context.Context, o metric.Float64Observer) error {
+					for set := range ci.sets {
+						ci.last[set] += cmc.next(ci, set)
+						o.Observe(ci.last[set], ci.sets[set])
+					}
+					return nil
+				}))
+			return ci, err
+		case kindObservableUpDownCounter:
+			_, err := cmc.meter.Float64ObservableUpDownCounter(name, unit, description, metric.WithFloat64Callback(cmc.observeFloat64(ci)))
+			return ci, err
+		case kindGauge, kindObservableGauge:
+			_, err := cmc.meter.Float64ObservableGauge(name, unit, description, metric.WithFloat64Callback(cmc.observeFloat64(ci)))
+			return ci, err
+		}
+		return ci, nil
+	}
+
+	switch spec.Kind {
+	case kindCounter:
+		c, err := cmc.meter.Int64Counter(name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		ci.record = func(ctx context.Context, set int, value float64) {
+			c.Add(ctx, int64(value), ci.sets[set])
+		}
+	case kindUpDownCounter:
+		c, err := cmc.meter.Int64UpDownCounter(name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		ci.record = func(ctx context.Context, set int, value float64) {
+			c.Add(ctx, int64(value-ci.last[set]), ci.sets[set])
+			ci.last[set] = value
+		}
+	case kindHistogram:
+		h, err := cmc.meter.Int64Histogram(name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		ci.record = func(ctx context.Context, set int, value float64) {
+			h.Record(ctx, int64(value), ci.sets[set])
+		}
+	case kindObservableCounter:
+		_, err := cmc.meter.Int64ObservableCounter(name, unit, description, metric.WithInt64Callback(
+			func(ctx context.Context, o metric.Int64Observer) error {
+				for set := range ci.sets {
+					ci.last[set] += cmc.next(ci, set)
+					o.Observe(int64(ci.last[set]), ci.sets[set])
+				}
+				return nil
+			}))
+		return ci, err
+	case kindObservableUpDownCounter:
+		_, err := cmc.meter.Int64ObservableUpDownCounter(name, unit, description, metric.WithInt64Callback(cmc.observeInt64(ci)))
+		return ci, err
+	case kindGauge, kindObservableGauge:
+		_, err := cmc.meter.Int64ObservableGauge(name, unit, description, metric.WithInt64Callback(cmc.observeInt64(ci)))
+		return ci, err
+	}
+	return ci, nil
+}
+
+// observeInt64 returns a callback observing the next value of ci for each attribute set.
+func (cmc *customMetricCollector) observeInt64(ci *customInstrument) metric.Int64Callback {
+	return func(ctx context.Context, o metric.Int64Observer) error {
+		for set := range ci.sets {
+			o.Observe(int64(cmc.next(ci, set)), ci.sets[set])
+		}
+		return nil
+	}
+}
+
+// observeFloat64 returns a callback observing the next value of ci for each attribute set.
+func (cmc *customMetricCollector) observeFloat64(ci *customInstrument) metric.Float64Callback {
+	return func(ctx context.Context, o metric.Float64Observer) error {
+		for set := range ci.sets {
+			o.Observe(cmc.next(ci, set), ci.sets[set])
+		}
+		return nil
+	}
+}
+
+// next returns the next value of ci for an attribute set, a whole number for int instruments.
+func (cmc *customMetricCollector) next(ci *customInstrument, set int) float64 {
+	key := ci.spec.Name + "/" + strconv.Itoa(set)
+	if ci.spec.ValueType == valueTypeFloat {
+		return cmc.generators.floatValue(key, ci.spec.Generator, ci.upperBound)
+	}
+	return float64(cmc.generators.value(key, ci.spec.Generator, int64(ci.upperBound)))
+}
+
+// RegisterMetricsClient records new values of the synchronous instruments every TimeInterval until ctx is done.
+func (cmc *customMetricCollector) RegisterMetricsClient(ctx context.Context) {
+	go func() {
+		interval := currentConfig().TimeInterval
+		ticker := time.NewTicker(time.Second * time.Duration(interval))
+		defer ticker.Stop()
+		for {
+			if cfg := currentConfig(); cfg.TimeInterval != interval {
+				interval = cfg.TimeInterval
+				ticker.Reset(time.Second * time.Duration(interval))
+			}
+			for _, ci := range cmc.instruments {
+				if ci.record == nil {
+					continue
+				}
+				for set := range ci.sets {
+					ci.record(ctx, set, cmc.next(ci, set))
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// attributeSets returns the measurement option of each attribute set, the common attributes alone when there are none.
+func attributeSets(sets [][]string) []metric.MeasurementOption {
+	if len(sets) == 0 {
+		return []metric.MeasurementOption{metric.WithAttributes(customMetricCommonLabels...)}
+	}
+	options := make([]metric.MeasurementOption, 0, len(sets))
+	for _, set := range sets {
+		attrs := append([]attribute.KeyValue{}, customMetricCommonLabels...)
+		for _, entry := range set {
+			key, value, _ := strings.Cut(entry, "=")
+			attrs = append(attrs, attribute.String(key, value))
+		}
+		options = append(options, metric.WithAttributes(attrs...))
+	}
+	return options
+}
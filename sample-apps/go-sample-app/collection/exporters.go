@@ -0,0 +1,165 @@
+package collection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// Exporter modes accepted by TracesExporter and MetricsExporter (OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER).
+const (
+	exporterOtlp    = "otlp"
+	exporterStdout  = "stdout"
+	exporterConsole = "console"
+	exporterFile    = "file"
+	exporterNone    = "none"
+)
+
+// OTLP protocols accepted by OtlpProtocol (OTEL_EXPORTER_OTLP_PROTOCOL).
+const (
+	protocolGrpc         = "grpc"
+	protocolHttpProtobuf = "http/protobuf"
+)
+
+// newTraceExporter creates the span exporter selected by cfg.TracesExporter, nil for none.
+// The returned closer releases any file opened by the exporter and may be nil.
+func newTraceExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.TracesExporter {
+	case exporterNone:
+		return nil, nil, nil
+	case exporterOtlp:
+		return newOtlpTraceExporter(ctx, cfg)
+	case exporterStdout, exporterConsole:
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exp, nil, err
+	case exporterFile:
+		// Each span is written as a single JSON object per line.
+		f, err := openExportFile(cfg.TracesExportFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		return exp, f, err
+	}
+	return nil, nil, fmt.Errorf("unsupported traces exporter %q", cfg.TracesExporter)
+}
+
+// newMetricExporter creates the metric exporter selected by cfg.MetricsExporter, nil for none.
+// The returned closer releases any file opened by the exporter and may be nil.
+func newMetricExporter(ctx context.Context, cfg *Config) (metric.Exporter, io.Closer, error) {
+	temporality, err := newTemporalitySelector(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch cfg.MetricsExporter {
+	case exporterNone:
+		return nil, nil, nil
+	case exporterOtlp:
+		return newOtlpMetricExporter(ctx, cfg, temporality)
+	case exporterStdout, exporterConsole:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		exp, err := stdoutmetric.New(stdoutmetric.WithEncoder(enc), stdoutmetric.WithTemporalitySelector(temporality))
+		return exp, nil, err
+	case exporterFile:
+		// Each collection is written as a single JSON object per line.
+		f, err := openExportFile(cfg.MetricsExportFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		exp, err := stdoutmetric.New(stdoutmetric.WithEncoder(json.NewEncoder(f)), stdoutmetric.WithTemporalitySelector(temporality))
+		return exp, f, err
+	}
+	return nil, nil, fmt.Errorf("unsupported metrics exporter %q", cfg.MetricsExporter)
+}
+
+// newOtlpTraceExporter creates an OTLP span exporter using cfg.OtlpProtocol, secured with TLS when enabled in cfg.
+func newOtlpTraceExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, io.Closer, error) {
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch cfg.OtlpProtocol {
+	case protocolGrpc:
+		var opts []otlptracegrpc.Option
+		if tlsCfg != nil {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			// INSECURE !! NOT TO BE USED FOR ANYTHING IN PRODUCTION
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(cfg.ExporterHeaders) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.ExporterHeaders))
+		}
+		exp, err := otlptracegrpc.New(ctx, opts...)
+		return exp, nil, err
+	case protocolHttpProtobuf:
+		var opts []otlptracehttp.Option
+		if tlsCfg != nil {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+		} else {
+			// INSECURE !! NOT TO BE USED FOR ANYTHING IN PRODUCTION
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.ExporterHeaders) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.ExporterHeaders))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		return exp, nil, err
+	}
+	return nil, nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.OtlpProtocol)
+}
+
+// newOtlpMetricExporter creates an OTLP metric exporter using cfg.OtlpProtocol and the given temporality, secured with TLS when enabled in cfg.
+func newOtlpMetricExporter(ctx context.Context, cfg *Config, temporality metric.TemporalitySelector) (metric.Exporter, io.Closer, error) {
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch cfg.OtlpProtocol {
+	case protocolGrpc:
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithTemporalitySelector(temporality)}
+		if tlsCfg != nil {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			// INSECURE !! NOT TO BE USED FOR ANYTHING IN PRODUCTION
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		if len(cfg.ExporterHeaders) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.ExporterHeaders))
+		}
+		exp, err := otlpmetricgrpc.New(ctx, opts...)
+		return exp, nil, err
+	case protocolHttpProtobuf:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithTemporalitySelector(temporality)}
+		if tlsCfg != nil {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsCfg))
+		} else {
+			// INSECURE !! NOT TO BE USED FOR ANYTHING IN PRODUCTION
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if len(cfg.ExporterHeaders) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.ExporterHeaders))
+		}
+		exp, err := otlpmetrichttp.New(ctx, opts...)
+		return exp, nil, err
+	}
+	return nil, nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.OtlpProtocol)
+}
+
+// openExportFile opens path for appending, creating it if it does not exist.
+func openExportFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
@@ -0,0 +1,154 @@
+package collection
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Shapes accepted by the Shape of a ValueGenerator.
+const (
+	shapeUniform  = "uniform"
+	shapeNormal   = "normal"
+	shapeSine     = "sine"
+	shapeSawtooth = "sawtooth"
+	shapeTriangle = "triangle"
+	shapeStep     = "step"
+	shapeSpike    = "spike"
+)
+
+// Defaults for the ValueGenerator settings left unset.
+const (
+	defaultGeneratorPeriod = 60
+	defaultAmplitude       = 0.5
+	defaultStdDev          = 0.15
+	defaultSteps           = 4
+)
+
+// ValueGenerator shapes the values of a random metric instrument between 0 and its Random*UpperBound.
+// Amplitude, StdDev and Baseline are fractions of the upper bound.
+type ValueGenerator struct {
+	Shape     string  `mapstructure:"Shape"`
+	Period    int64   `mapstructure:"Period"`
+	Amplitude float64 `mapstructure:"Amplitude"`
+	StdDev    float64 `mapstructure:"StdDev"`
+	Steps     int64   `mapstructure:"Steps"`
+	Baseline  float64 `mapstructure:"Baseline"`
+}
+
+// generatorInstruments are the random metric instruments a ValueGenerator can be configured for.
+var generatorInstruments = []string{cpuUsage, totalHeapSize, threadsActive}
+
+// isGeneratorInstrument reports whether name is one of the generatorInstruments.
+func isGeneratorInstrument(name string) bool {
+	for _, instrument := range generatorInstruments {
+		if name == instrument {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the generator configured for the instrument name.
+func (g ValueGenerator) validate(name string) error {
+	switch g.Shape {
+	case "", shapeUniform, shapeNormal, shapeSine, shapeSawtooth, shapeTriangle, shapeStep, shapeSpike:
+	default:
+		return fmt.Errorf("generator of %s: unsupported shape %q", name, g.Shape)
+	}
+	if g.Period < 0 || g.Steps < 0 || g.Amplitude < 0 || g.StdDev < 0 {
+		return fmt.Errorf("generator of %s: Period, Steps, Amplitude and StdDev must not be negative", name)
+	}
+	if g.Baseline < 0 || g.Baseline > 1 {
+		return fmt.Errorf("generator of %s: Baseline must be between 0 and 1, got %g", name, g.Baseline)
+	}
+	return nil
+}
+
+// generators produces the values of the random and custom metric instruments from their configured ValueGenerator.
+type generators struct {
+	mu         sync.Mutex
+	start      time.Time
+	rands      *lockedRands
+	lastPeriod map[string]int64
+}
+
+// newGenerators returns generators whose periods start now and whose random shapes draw from the sequences of seed and stream,
+// one per instrument.
+func newGenerators(seed int64, stream int64) *generators {
+	return &generators{start: time.Now(), rands: newLockedRands(seed, stream), lastPeriod: map[string]int64{}}
+}
+
+// value returns the next value of the instrument name between 0 and upperBound, following g, or 0 when upperBound is not positive.
+func (gs *generators) value(name string, g ValueGenerator, upperBound int64) int64 {
+	if upperBound <= 0 {
+		return 0
+	}
+	if g.Shape == "" || g.Shape == shapeUniform {
+		return int64(gs.rands.of(name).Intn(int(upperBound)))
+	}
+	return int64(math.Round(gs.fraction(name, g) * float64(upperBound)))
+}
+
+// floatValue returns the next value of the instrument name between 0 and upperBound, following g.
+func (gs *generators) floatValue(name string, g ValueGenerator, upperBound float64) float64 {
+	if g.Shape == "" || g.Shape == shapeUniform {
+		return gs.rands.of(name).Float64() * upperBound
+	}
+	return gs.fraction(name, g) * upperBound
+}
+
+// fraction returns the next value of the instrument name as a fraction of its upper bound, following the shape of g.
+func (gs *generators) fraction(name string, g ValueGenerator) float64 {
+	period := time.Second * time.Duration(g.Period)
+	if period == 0 {
+		period = time.Second * defaultGeneratorPeriod
+	}
+	elapsed := time.Since(gs.start)
+	phase := float64(elapsed%period) / float64(period)
+
+	var f float64
+	switch g.Shape {
+	case shapeNormal:
+		stdDev := g.StdDev
+		if stdDev == 0 {
+			stdDev = defaultStdDev
+		}
+		f = 0.5 + stdDev*gs.rands.of(name).NormFloat64()
+	case shapeSine:
+		amplitude := g.Amplitude
+		if amplitude == 0 {
+			amplitude = defaultAmplitude
+		}
+		f = 0.5 + amplitude*math.Sin(2*math.Pi*phase)
+	case shapeSawtooth:
+		f = phase
+	case shapeTriangle:
+		f = 1 - math.Abs(2*phase-1)
+	case shapeStep:
+		steps := g.Steps
+		if steps == 0 {
+			steps = defaultSteps
+		}
+		f = math.Floor(phase*float64(steps)) / float64(steps)
+	case shapeSpike:
+		// The first value of every period is the spike, so each spike is observed whatever the collection interval
+		f = g.Baseline
+		if gs.newPeriod(name, int64(elapsed/period)) {
+			f = 1
+		}
+	default:
+		f = gs.rands.of(name).Float64()
+	}
+	return math.Max(0, math.Min(1, f))
+}
+
+// newPeriod reports whether index is a later period than the previous value of the instrument name was in.
+func (gs *generators) newPeriod(name string, index int64) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	last, ok := gs.lastPeriod[name]
+	gs.lastPeriod[name] = index
+	return !ok || index > last
+}
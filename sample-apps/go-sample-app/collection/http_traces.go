@@ -3,41 +3,54 @@ package collection
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // Contains all of the endpoint logic.
 
+// Baggage member carrying the number of sample app hops made so far in a call chain.
+const depthBaggageKey = "sampleapp.depth"
+
+// Entry of LeafUrls that calls the built-in echo endpoint instead of an external URL.
+const localLeaf = "local"
+
+// Values accepted by SampleAppFanOut.
+const (
+	fanOutSequential = "sequential"
+	fanOutParallel   = "parallel"
+)
+
 type response struct {
 	TraceID string `json:"traceId"`
+	Error   string `json:"error,omitempty"`
 }
 
-type s3Client struct {
-	client *s3.S3
+type echoResponse struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Headers map[string][]string `json:"headers"`
 }
 
-func NewS3Client() (*s3Client, error) {
-	s, err := session.NewSession()
-	if err != nil {
-		return nil, err
-	}
-	svc := s3.New(s)
-	return &s3Client{client: svc}, nil
-}
-
-// AwsSdkCall mocks a request to s3. ListBuckets are nil so no credentials are needed.
-// Generates an Xray Trace ID.
-func AwsSdkCall(w http.ResponseWriter, r *http.Request, rqmc *requestBasedMetricCollector, s3 *s3Client) {
+// AwsSdkCall makes each of the AwsSdkCalls, S3 ListBuckets by default, and generates an Xray Trace ID.
+// Each call is traced as a client span; a failed call is recorded on the span without failing the response.
+func AwsSdkCall(w http.ResponseWriter, r *http.Request, awsClient *awsClient) {
 	w.Header().Set("Content-Type", "application/json")
 
-	s3.client.ListBuckets(nil) // nil or else would need real aws credentials
-
 	ctx, span := tracer.Start(
 		r.Context(),
 		"aws-sdk-call",
@@ -45,89 +58,195 @@ func AwsSdkCall(w http.ResponseWriter, r *http.Request, rqmc *requestBasedMetric
 	)
 	defer span.End()
 
-	// Request based metrics provided by rqmc
-	rqmc.AddApiRequest()
-	rqmc.UpdateTotalBytesSent(ctx)
-	rqmc.UpdateLatencyTime(ctx)
-
+	// As the default call needs AWS credentials, a failed call is only recorded on the span and the response stays successful
+	if err := awsClient.callAll(ctx, currentConfig()); err != nil {
+		recordSpanError(span, err)
+	}
 	writeResponse(span, w)
 }
 
-// OutgoingSampleApp makes a request to another Sampleapp and generates an Xray Trace ID. It will also make a request to amazon.com.
-func OutgoingSampleApp(w http.ResponseWriter, r *http.Request, client http.Client, rqmc *requestBasedMetricCollector) {
+// OutgoingSampleApp makes a request to every downstream Sampleapp and generates an Xray Trace ID. It will make a request to the LeafUrls
+// instead when there are no downstream Sampleapps. The number of hops is carried in baggage and no further calls are made past SampleAppMaxDepth.
+func OutgoingSampleApp(w http.ResponseWriter, r *http.Request, client http.Client) {
+
+	// The hop depth is always carried in the baggage header, so cycles are cut even when the baggage propagator is not configured
+	ctx := propagation.Baggage{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	depth := hopDepth(ctx)
 
 	ctx, span := tracer.Start(
-		r.Context(),
+		ctx,
 		"invoke-sample-apps",
 		trace.WithAttributes(traceCommonLabels...),
+		trace.WithAttributes(attribute.Int(depthBaggageKey, depth)),
 	)
 	defer span.End()
-	count := len(rqmc.config.SampleAppPorts)
+	cfg := currentConfig()
+	count := len(cfg.SampleAppPorts)
 
-	// If there are no sample app port list is empty then make a request to amazon.com (leaf request)
+	// If there are no sample app port list is empty then make a request to the leaf URLs (leaf request)
 	if count == 0 {
-		ctx, span := tracer.Start(
+		ctx, leafSpan := tracer.Start(
 			ctx,
 			"leaf-request",
 			trace.WithAttributes(traceCommonLabels...),
 		)
 
-		req, _ := http.NewRequestWithContext(ctx, "GET", "https://aws.amazon.com", nil)
-		res, err := client.Do(req)
+		err := callLeafUrls(ctx, client, cfg)
 		if err != nil {
-			fmt.Println(err)
+			recordSpanError(leafSpan, err)
+		}
+		leafSpan.End()
+		if err != nil {
+			recordSpanError(span, err)
+			writeErrorResponse(span, w, err)
+			return
 		}
 
-		defer res.Body.Close()
-		// Request based metrics provided by rqmc
-		rqmc.AddApiRequest()
-		rqmc.UpdateTotalBytesSent(ctx)
-		rqmc.UpdateLatencyTime(ctx)
-
-		span.End()
+	} else if depth >= int(cfg.SampleAppMaxDepth) { // Stops the chain, e.g. when sample apps call each other in a cycle
+		fmt.Printf("Not invoking sample apps, maximum depth of %d reached\n", cfg.SampleAppMaxDepth)
+		span.AddEvent("max-depth-reached")
 
 	} else { // If there are sample app ports to make a request to (chain request)
-		invokeSampleApps(ctx, client, rqmc)
+		err := invokeSampleApps(withHopDepth(ctx, depth+1), client, cfg)
+		if err != nil {
+			recordSpanError(span, err)
+			writeErrorResponse(span, w, err)
+			return
+		}
 	}
 	writeResponse(span, w)
 
 }
 
-// invokeSampleApps loops through the list of sample app ports provided in the configuration file and makes a call to invoke().
-func invokeSampleApps(ctx context.Context, client http.Client, rqmc *requestBasedMetricCollector) {
+// invokeSampleApps makes a call to invoke() for every downstream sample app provided in the configuration file,
+// one after another or all at once depending on SampleAppFanOut, and returns the failed calls.
+// Each call gives up after the Timeout of its entry, SampleAppTimeout by default.
+func invokeSampleApps(ctx context.Context, client http.Client, cfg *Config) error {
 
-	for _, port := range rqmc.config.SampleAppPorts {
-		if port != "" {
-			invoke(ctx, port, client)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	call := func(target string, timeout time.Duration) {
+		if err := invoke(ctx, target, client, timeout); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	}
+	for _, app := range cfg.SampleAppPorts {
+		target, err := sampleAppURL(app.Port)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		timeout := time.Second * time.Duration(cfg.SampleAppTimeout)
+		if app.Timeout > 0 {
+			timeout = time.Second * time.Duration(app.Timeout)
+		}
+		if cfg.SampleAppFanOut == fanOutParallel {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				call(target, timeout)
+			}()
+		} else {
+			call(target, timeout)
 		}
 	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-// invoke uses the port given in the parameters to make an http request.
-func invoke(ctx context.Context, port string, client http.Client) {
+// invoke makes an http request to the downstream sample app at target, giving up after timeout.
+// A call fails when it cannot be made or the sample app responds with a server error.
+func invoke(ctx context.Context, target string, client http.Client, timeout time.Duration) error {
 
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 	ctx, span := tracer.Start(
 		ctx,
 		"invoke-sample-app",
 		trace.WithAttributes(traceCommonLabels...),
+		trace.WithAttributes(attribute.String("sampleapp.target", target)),
 	)
-	// Consider making requests on other than localhost
-	addr := "http://" + net.JoinHostPort("0.0.0.0", port) + "/outgoing-sampleapp"
-	fmt.Println(addr)
-	req, _ := http.NewRequestWithContext(ctx, "GET", addr, nil)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+	propagation.Baggage{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
 	res, err := client.Do(req)
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		err := fmt.Errorf("GET %s: %s", target, res.Status)
+		recordSpanError(span, err)
+		return err
+	}
+	return nil
+}
+
+// sampleAppURL returns the URL to call for the Port of a SampleAppPorts entry. It is a full URL, a host:port pair or,
+// as in earlier versions, only a port on the local host. The /outgoing-sampleapp path is used when it has no path.
+func sampleAppURL(entry string) (string, error) {
+	if !strings.Contains(entry, "://") {
+		if !strings.Contains(entry, ":") {
+			entry = net.JoinHostPort("0.0.0.0", entry)
+		}
+		entry = "http://" + entry
+	}
+	u, err := url.Parse(entry)
+	if err != nil {
+		return "", fmt.Errorf("invalid sample app %q: %w", entry, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid sample app %q: missing host", entry)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/outgoing-sampleapp"
+	}
+	return u.String(), nil
+}
 
+// hopDepth returns the number of sample app hops made so far, as carried in baggage.
+func hopDepth(ctx context.Context) int {
+	depth, err := strconv.Atoi(baggage.FromContext(ctx).Member(depthBaggageKey).Value())
 	if err != nil {
-		fmt.Println(err)
+		return 0
 	}
+	return depth
+}
 
-	defer res.Body.Close()
-	defer span.End()
+// withHopDepth returns a copy of ctx whose baggage carries depth as the number of sample app hops.
+func withHopDepth(ctx context.Context, depth int) context.Context {
+	member, err := baggage.NewMember(depthBaggageKey, strconv.Itoa(depth))
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
 
+// recordSpanError records err on span and marks the span as failed.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
 
-// OutgoingHttpCall makes an HTTP GET request to https://aws.amazon.com/ and generates an Xray Trace ID.
-func OutgoingHttpCall(w http.ResponseWriter, r *http.Request, client http.Client, rqmc *requestBasedMetricCollector) {
+// OutgoingHttpCall makes an HTTP GET request to each of the LeafUrls, https://aws.amazon.com by default, and generates an Xray Trace ID.
+func OutgoingHttpCall(w http.ResponseWriter, r *http.Request, client http.Client) {
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -139,20 +258,52 @@ func OutgoingHttpCall(w http.ResponseWriter, r *http.Request, client http.Client
 
 	defer span.End()
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", "https://aws.amazon.com/", nil)
-	res, err := client.Do(req)
+	err := callLeafUrls(ctx, client, currentConfig())
 	if err != nil {
-		fmt.Println(err)
+		recordSpanError(span, err)
+		writeErrorResponse(span, w, err)
+		return
 	}
+	writeResponse(span, w)
 
-	defer res.Body.Close()
+}
 
-	// Request based metrics provided by rqmc
-	rqmc.AddApiRequest()
-	rqmc.UpdateTotalBytesSent(ctx)
-	rqmc.UpdateLatencyTime(ctx)
-	writeResponse(span, w)
+// Echo responds with the method, path and headers of the request. It is the built-in leaf target used by the "local" entry of LeafUrls.
+func Echo(w http.ResponseWriter, r *http.Request) {
+	payload, _ := json.Marshal(echoResponse{Method: r.Method, Path: r.URL.Path, Headers: r.Header})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
 
+// callLeafUrls makes an HTTP GET request to each of the LeafUrls in turn and returns the first failure.
+// A request fails when it cannot be made or the leaf responds with a server error.
+func callLeafUrls(ctx context.Context, client http.Client, cfg *Config) error {
+	for _, entry := range cfg.LeafUrls {
+		target := leafURL(entry, cfg)
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("GET %s: %s", target, res.Status)
+		}
+	}
+	return nil
+}
+
+// leafURL returns the URL to call for an entry of LeafUrls, resolving "local" to the built-in echo endpoint of this application.
+func leafURL(entry string, cfg *Config) string {
+	if entry == localLeaf {
+		return "http://" + net.JoinHostPort(cfg.Host, cfg.Port) + "/echo"
+	}
+	return entry
 }
 
 // getXrayTraceID generates a trace ID in Xray format from the span context.
@@ -161,6 +312,15 @@ func getXrayTraceID(span trace.Span) string {
 	return fmt.Sprintf("1-%s-%s", xrayTraceID[0:8], xrayTraceID[8:])
 }
 
+// writeErrorResponse writes a 502 response carrying the Xray Trace ID and err.
+func writeErrorResponse(span trace.Span, w http.ResponseWriter, err error) {
+	xrayTraceID := getXrayTraceID(span)
+	payload, _ := json.Marshal(response{TraceID: xrayTraceID, Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write(payload)
+}
+
 func writeResponse(span trace.Span, w http.ResponseWriter) {
 	xrayTraceID := getXrayTraceID(span)
 	payload, _ := json.Marshal(response{TraceID: xrayTraceID})
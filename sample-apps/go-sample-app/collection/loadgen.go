@@ -0,0 +1,258 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Endpoints called in equal proportions when LoadgenMix is empty.
+var defaultLoadgenMix = map[string]int64{
+	"/aws-sdk-call":       1,
+	"/outgoing-http-call": 1,
+	"/outgoing-sampleapp": 1,
+}
+
+// endpointStats holds the outcome of the requests made to an endpoint.
+type endpointStats struct {
+	requests  int64
+	errors    int64
+	statuses  map[int]int64
+	latencies []time.Duration
+}
+
+// loadGenerator calls the endpoints of LoadgenMix at LoadgenRps requests per second from LoadgenConcurrency workers.
+type loadGenerator struct {
+	cfg       *Config
+	client    http.Client
+	endpoints []string
+	weights   []int64
+	total     int64
+	rand      *lockedRand
+
+	mu      sync.Mutex
+	stats   map[string]*endpointStats
+	skipped int64
+}
+
+// RunLoadGenerator calls the endpoints of the sample app at LoadgenTarget for LoadgenDuration seconds, or until ctx is done
+// when LoadgenDuration is 0, then prints a summary of the latencies and errors of each endpoint.
+// Each request is traced and its context propagated, so the generated traces link with those of the sample app.
+func RunLoadGenerator(ctx context.Context, cfg *Config) {
+	lg := newLoadGenerator(cfg)
+
+	runCtx := ctx
+	if cfg.LoadgenDuration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(cfg.LoadgenDuration))
+		defer cancel()
+	}
+
+	fmt.Printf("Generating %g requests/s on %s from %d workers\n", cfg.LoadgenRps, cfg.LoadgenTarget, cfg.LoadgenConcurrency)
+	start := time.Now()
+	// In-flight requests are only cut short when ctx is done, not at the end of LoadgenDuration
+	lg.schedule(runCtx, ctx, start)
+
+	lg.printSummary(os.Stdout, time.Since(start))
+}
+
+// newLoadGenerator returns a loadGenerator for the endpoints and weights of LoadgenMix.
+func newLoadGenerator(cfg *Config) *loadGenerator {
+	mix := cfg.LoadgenMix
+	if len(mix) == 0 {
+		mix = defaultLoadgenMix
+	}
+	lg := &loadGenerator{
+		cfg: cfg,
+		client: http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Second * time.Duration(cfg.LoadgenTimeout),
+		},
+		rand:  newLockedRand(cfg.Seed, loadgenStream, ""),
+		stats: map[string]*endpointStats{},
+	}
+	for endpoint := range mix {
+		lg.endpoints = append(lg.endpoints, endpoint)
+	}
+	// Sorted so a given Seed picks the same sequence of endpoints
+	sort.Strings(lg.endpoints)
+	for _, endpoint := range lg.endpoints {
+		lg.total += mix[endpoint]
+		lg.weights = append(lg.weights, lg.total)
+		lg.stats[endpoint] = &endpointStats{statuses: map[int]int64{}}
+	}
+	return lg
+}
+
+// schedule starts a request with callCtx at the rate in effect until ctx is done, then waits for the requests in flight.
+// A request is skipped when LoadgenConcurrency requests are still in flight, i.e. every worker is busy, so a slow
+// sample app lowers the rate achieved rather than queueing requests.
+func (lg *loadGenerator) schedule(ctx, callCtx context.Context, start time.Time) {
+	// Holds a token per request in flight, so a worker is free whenever it has room
+	workers := make(chan struct{}, lg.cfg.LoadgenConcurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	next := start
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		// A tick due at the end of LoadgenDuration may fire before the deadline of ctx cancels it
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return
+		}
+		select {
+		case workers <- struct{}{}:
+			wg.Add(1)
+			go func(endpoint string) {
+				defer wg.Done()
+				lg.call(callCtx, endpoint)
+				<-workers
+			}(lg.pick())
+		default:
+			lg.mu.Lock()
+			lg.skipped++
+			lg.mu.Unlock()
+		}
+		next = next.Add(time.Duration(float64(time.Second) / lg.rate(time.Since(start))))
+		timer.Reset(time.Until(next))
+	}
+}
+
+// rate returns the requests per second to make once elapsed has passed, rising linearly to LoadgenRps over LoadgenRampUp seconds.
+func (lg *loadGenerator) rate(elapsed time.Duration) float64 {
+	rps := lg.cfg.LoadgenRps
+	rampUp := time.Second * time.Duration(lg.cfg.LoadgenRampUp)
+	if elapsed >= rampUp {
+		return rps
+	}
+	// At least one request per second, so the ramp up does not start with a long pause
+	return math.Max(rps*float64(elapsed)/float64(rampUp), math.Min(rps, 1))
+}
+
+// pick returns a random endpoint in the proportions of LoadgenMix.
+func (lg *loadGenerator) pick() string {
+	n := int64(lg.rand.Intn(int(lg.total)))
+	i := sort.Search(len(lg.weights), func(i int) bool { return lg.weights[i] > n })
+	return lg.endpoints[i]
+}
+
+// call makes a request to endpoint as part of a new trace and records its outcome.
+// A request fails when it cannot be made or the sample app responds with an error status.
+func (lg *loadGenerator) call(ctx context.Context, endpoint string) {
+	ctx, span := tracer.Start(
+		ctx,
+		"loadgen-request",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(traceCommonLabels...),
+		trace.WithAttributes(attribute.String("loadgen.endpoint", endpoint)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	status, err := lg.get(ctx, strings.TrimSuffix(lg.cfg.LoadgenTarget, "/")+endpoint)
+	latency := time.Since(start)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	stats := lg.stats[endpoint]
+	stats.requests++
+	stats.latencies = append(stats.latencies, latency)
+	if status != 0 {
+		stats.statuses[status]++
+	}
+	if err != nil {
+		stats.errors++
+	}
+}
+
+// get makes a GET request to target and returns the status code of the response.
+func (lg *loadGenerator) get(ctx context.Context, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := lg.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return res.StatusCode, fmt.Errorf("GET %s: %s", target, res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// printSummary writes the number of requests, errors, status codes and latency percentiles of each endpoint to w.
+func (lg *loadGenerator) printSummary(w io.Writer, elapsed time.Duration) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	var requests, errors int64
+	for _, stats := range lg.stats {
+		requests += stats.requests
+		errors += stats.errors
+	}
+	fmt.Fprintf(w, "\n%d requests in %.1fs (%.1f requests/s), %d errors, %d skipped with all workers busy\n\n",
+		requests, elapsed.Seconds(), float64(requests)/elapsed.Seconds(), errors, lg.skipped)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tREQUESTS\tERRORS\tSTATUS CODES\tP50 (ms)\tP90 (ms)\tP99 (ms)\tMAX (ms)")
+	for _, endpoint := range lg.endpoints {
+		stats := lg.stats[endpoint]
+		sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.1f\t%.1f\t%.1f\t%.1f\n", endpoint, stats.requests, stats.errors, formatStatuses(stats.statuses),
+			percentile(stats.latencies, 50), percentile(stats.latencies, 90), percentile(stats.latencies, 99), percentile(stats.latencies, 100))
+	}
+	tw.Flush()
+}
+
+// formatStatuses returns the number of responses with each status code, e.g. "200:97 502:3".
+func formatStatuses(statuses map[int]int64) string {
+	if len(statuses) == 0 {
+		return "-"
+	}
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	counts := make([]string, len(codes))
+	for i, code := range codes {
+		counts[i] = fmt.Sprintf("%d:%d", code, statuses[code])
+	}
+	return strings.Join(counts, " ")
+}
+
+// percentile returns the p-th percentile of the sorted latencies in milliseconds, 0 when there are none.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
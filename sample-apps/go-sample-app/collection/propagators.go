@@ -0,0 +1,43 @@
+package collection
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagators accepted by Propagators (OTEL_PROPAGATORS).
+const (
+	propagatorTraceContext = "tracecontext"
+	propagatorBaggage      = "baggage"
+	propagatorB3           = "b3"
+	propagatorB3Multi      = "b3multi"
+	propagatorXray         = "xray"
+	propagatorNone         = "none"
+)
+
+// newPropagator builds a composite propagator from cfg.Propagators, injecting and extracting each configured format in order.
+func newPropagator(cfg *Config) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range cfg.Propagators {
+		switch strings.TrimSpace(name) {
+		case propagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case propagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case propagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case propagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case propagatorXray:
+			propagators = append(propagators, xray.Propagator{})
+		case propagatorNone, "":
+		default:
+			return nil, fmt.Errorf("unsupported propagator %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
@@ -3,11 +3,10 @@ package collection
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/metric/instrument"
 )
 
 var (
@@ -16,23 +15,55 @@ var (
 )
 
 // randomMetricCollector contains all the random based metric instruments.
+// When MetricsSource is runtime the instruments observe the process instead of random values.
 type randomMetricCollector struct {
-	timeAlive     instrument.Int64Counter
-	cpuUsage      instrument.Int64ObservableGauge
-	totalHeapSize instrument.Int64ObservableUpDownCounter
-	threadsActive instrument.Int64UpDownCounter
+	timeAlive     metric.Int64Counter
+	cpuUsage      metric.Int64ObservableGauge
+	totalHeapSize metric.Int64ObservableUpDownCounter
+	threadsActive metric.Int64UpDownCounter
 	meter         metric.Meter
+	labels        []attribute.KeyValue
+	runtime       *runtimeSource
+	generators    *generators
+	cardinality   *cardinality
+
+	// Float64 counterparts of the instruments, registered when FloatMetrics is enabled
+	floats             bool
+	timeAliveFloat     metric.Float64Counter
+	cpuUsageFloat      metric.Float64ObservableGauge
+	totalHeapSizeFloat metric.Float64ObservableUpDownCounter
+	threadsActiveFloat metric.Float64UpDownCounter
+	floatGenerators    *generators
 }
 
 // NewRandomMetricCollector returns a new type struct that holds and registers the 4 random based metric instruments used in the Go-Sample-App;
-// HeapSize, ThreadsActive, TimeAlive, CpuUsage
+// HeapSize, ThreadsActive, TimeAlive, CpuUsage. The contrib runtime and host instrumentation is also started when enabled.
 func NewRandomMetricCollector(mp metric.MeterProvider) randomMetricCollector {
-	rmc := randomMetricCollector{}
+	cfg := currentConfig()
+	rmc := randomMetricCollector{
+		labels:      randomMetricCommonLabels,
+		generators:  newGenerators(cfg.Seed, randomMetricsStream),
+		cardinality: newCardinality(cfg.Seed, randomCardinalityStream),
+	}
+	if cfg.MetricsSource == metricsSourceRuntime {
+		rs, err := newRuntimeSource()
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			rmc.runtime = rs
+			rmc.labels = runtimeMetricCommonLabels
+		}
+	}
 	rmc.meter = mp.Meter("github.com/aws-otel-commnunity/sample-apps/go-sample-app/collection")
 	rmc.registerHeapSize()
 	rmc.registerThreadsActive()
 	rmc.registerTimeAlive()
 	rmc.registerCpuUsage()
+	if cfg.FloatMetrics {
+		rmc.floatGenerators = newGenerators(cfg.Seed, randomFloatMetricsStream)
+		rmc.registerFloatInstruments()
+	}
+	startContribMetrics(mp, cfg)
 	return rmc
 }
 
@@ -40,8 +71,8 @@ func NewRandomMetricCollector(mp metric.MeterProvider) randomMetricCollector {
 func (rmc *randomMetricCollector) registerTimeAlive() {
 	timeAliveMetric, err := rmc.meter.Int64Counter(
 		timeAlive+testingId,
-		instrument.WithDescription("Total amount of time that the application has been alive"),
-		instrument.WithUnit("ms"),
+		metric.WithDescription("Total amount of time that the application has been alive"),
+		metric.WithUnit("ms"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -53,8 +84,8 @@ func (rmc *randomMetricCollector) registerTimeAlive() {
 func (rmc *randomMetricCollector) registerCpuUsage() {
 	cpuUsageMetric, err := rmc.meter.Int64ObservableGauge(
 		cpuUsage+testingId,
-		instrument.WithDescription("Cpu usage percent"),
-		instrument.WithUnit("1"),
+		metric.WithDescription("Cpu usage percent"),
+		metric.WithUnit("1"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -67,8 +98,8 @@ func (rmc *randomMetricCollector) registerCpuUsage() {
 func (rmc *randomMetricCollector) registerHeapSize() {
 	totalHeapSizeMetric, err := rmc.meter.Int64ObservableUpDownCounter(
 		totalHeapSize+testingId,
-		instrument.WithDescription("The current total heap size"),
-		instrument.WithUnit("By"),
+		metric.WithDescription("The current total heap size"),
+		metric.WithUnit("By"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -81,8 +112,8 @@ func (rmc *randomMetricCollector) registerHeapSize() {
 func (rmc *randomMetricCollector) registerThreadsActive() {
 	threadsActiveMetric, err := rmc.meter.Int64UpDownCounter(
 		threadsActive+testingId,
-		instrument.WithUnit("1"),
-		instrument.WithDescription("The total amount of threads active"),
+		metric.WithUnit("1"),
+		metric.WithDescription("The total amount of threads active"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -90,66 +121,177 @@ func (rmc *randomMetricCollector) registerThreadsActive() {
 	rmc.threadsActive = threadsActiveMetric
 }
 
-// UpdateMetricsClient generates new metric values for Synchronous instruments every TimeInterval and
-// Asynchronous instruments every CollectPeriod configured by the controller.
-func (rmc *randomMetricCollector) RegisterMetricsClient(ctx context.Context, cfg Config) {
+// registerFloatInstruments registers the Float64 counterparts of TimeAlive, CpuUsage, HeapSize and ThreadsActive.
+func (rmc *randomMetricCollector) registerFloatInstruments() {
+	var err error
+	rmc.timeAliveFloat, err = rmc.meter.Float64Counter(
+		timeAlive+floatSuffix+testingId,
+		metric.WithDescription("Total amount of time that the application has been alive"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rmc.cpuUsageFloat, err = rmc.meter.Float64ObservableGauge(
+		cpuUsage+floatSuffix+testingId,
+		metric.WithDescription("Cpu usage percent"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rmc.totalHeapSizeFloat, err = rmc.meter.Float64ObservableUpDownCounter(
+		totalHeapSize+floatSuffix+testingId,
+		metric.WithDescription("The current total heap size"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rmc.threadsActiveFloat, err = rmc.meter.Float64UpDownCounter(
+		threadsActive+floatSuffix+testingId,
+		metric.WithUnit("1"),
+		metric.WithDescription("The total amount of threads active"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rmc.floats = true
+}
+
+// RegisterMetricsClient generates new metric values for Synchronous instruments every TimeInterval and
+// Asynchronous instruments every CollectPeriod configured by the controller. Synchronous updates stop once ctx is done.
+// The current configuration is read on every update so reloaded settings take effect without a restart.
+func (rmc *randomMetricCollector) RegisterMetricsClient(ctx context.Context) {
 	go func() {
+		interval := currentConfig().TimeInterval
+		ticker := time.NewTicker(time.Second * time.Duration(interval))
+		defer ticker.Stop()
 		for {
-			rmc.updateTimeAlive(ctx, cfg)
-			rmc.updateThreadsActive(ctx, cfg)
-			time.Sleep(time.Second * time.Duration(cfg.TimeInterval))
+			cfg := currentConfig()
+			if cfg.TimeInterval != interval {
+				interval = cfg.TimeInterval
+				ticker.Reset(time.Second * time.Duration(interval))
+			}
+			if rmc.runtime != nil {
+				rmc.updateRuntime(ctx)
+			} else {
+				rmc.updateTimeAlive(ctx, cfg)
+				rmc.updateThreadsActive(ctx, cfg)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 		}
 	}()
-	rmc.updateCpuUsage(ctx, cfg)
-	rmc.updateTotalHeapSize(ctx, cfg)
+	rmc.updateCpuUsage(ctx)
+	rmc.updateTotalHeapSize(ctx)
 }
 
 // updateTimeAlive updates TimeAlive by TimeAliveIncrementer increments.
-func (rmc *randomMetricCollector) updateTimeAlive(ctx context.Context, cfg Config) {
-	rmc.timeAlive.Add(ctx, cfg.TimeAliveIncrementer*1000, randomMetricCommonLabels...) // in millisconds
+func (rmc *randomMetricCollector) updateTimeAlive(ctx context.Context, cfg *Config) {
+	rmc.addTimeAlive(ctx, cfg.TimeAliveIncrementer*1000) // in millisconds
+}
+
+// addTimeAlive adds ms to TimeAlive and its Float64 counterpart.
+func (rmc *randomMetricCollector) addTimeAlive(ctx context.Context, ms int64) {
+	attrs := rmc.attributes(timeAlive)
+	rmc.timeAlive.Add(ctx, ms, attrs)
+	if rmc.floats {
+		rmc.timeAliveFloat.Add(ctx, float64(ms), attrs)
+	}
 }
 
-// updateCpuUsage updates CpuUsage by a value between 0 and CpuUsageUpperBound every SDK call.
-func (rmc *randomMetricCollector) updateCpuUsage(ctx context.Context, cfg Config) {
-	min := 0
-	max := int(cfg.CpuUsageUpperBound)
+// addThreadsActive adds delta to ThreadsActive and its Float64 counterpart.
+func (rmc *randomMetricCollector) addThreadsActive(ctx context.Context, delta int64) {
+	attrs := rmc.attributes(threadsActive)
+	rmc.threadsActive.Add(ctx, delta, attrs)
+	if rmc.floats {
+		rmc.threadsActiveFloat.Add(ctx, float64(delta), attrs)
+	}
+}
+
+// updateCpuUsage updates CpuUsage by a value between 0 and CpuUsageUpperBound shaped by its generator, or the CPU used by the process, every SDK call.
+func (rmc *randomMetricCollector) updateCpuUsage(ctx context.Context) {
 	if _, err := rmc.meter.RegisterCallback(
 		// SDK periodically calls this function to collect data.
 		func(ctx context.Context, o metric.Observer) error {
-			cpuUsage := int64(rand.Intn(max-min) + min)
-			o.ObserveInt64(rmc.cpuUsage, cpuUsage, randomMetricCommonLabels...)
+			attrs := rmc.attributes(cpuUsage)
+			if rmc.runtime != nil {
+				usage, err := rmc.runtime.cpuUsage()
+				if err != nil {
+					return err
+				}
+				o.ObserveInt64(rmc.cpuUsage, int64(usage), attrs)
+				if rmc.floats {
+					o.ObserveFloat64(rmc.cpuUsageFloat, usage, attrs)
+				}
+				return nil
+			}
+			cfg := currentConfig()
+			usage := rmc.generators.value(cpuUsage, cfg.RandomGenerators[cpuUsage], cfg.CpuUsageUpperBound)
+			o.ObserveInt64(rmc.cpuUsage, usage, attrs)
+			if rmc.floats {
+				usageFloat := rmc.floatGenerators.floatValue(cpuUsage, cfg.RandomGenerators[cpuUsage], float64(cfg.CpuUsageUpperBound))
+				o.ObserveFloat64(rmc.cpuUsageFloat, usageFloat, attrs)
+			}
 
 			return nil
 		},
-		rmc.cpuUsage,
+		rmc.observables(rmc.cpuUsage, rmc.cpuUsageFloat)...,
 	); err != nil {
 		panic(err)
 	}
 }
 
-// updateTotalHeapSize updates HeapSize by a value between 0 and TotalHeapSizeUpperBound every SDK call.
-func (rmc *randomMetricCollector) updateTotalHeapSize(ctx context.Context, cfg Config) {
-	min := 0
-	max := int(cfg.TotalHeapSizeUpperBound)
+// updateTotalHeapSize updates HeapSize by a value between 0 and TotalHeapSizeUpperBound shaped by its generator, or the size of the Go heap, every SDK call.
+func (rmc *randomMetricCollector) updateTotalHeapSize(ctx context.Context) {
 	if _, err := rmc.meter.RegisterCallback(
 		// SDK periodically calls this function to collect data.
 		func(ctx context.Context, o metric.Observer) error {
-			totalHeapSize := int64(rand.Intn(max-min) + min)
-			o.ObserveInt64(rmc.totalHeapSize, totalHeapSize, randomMetricCommonLabels...)
+			attrs := rmc.attributes(totalHeapSize)
+			if rmc.runtime != nil {
+				size := heapSize()
+				o.ObserveInt64(rmc.totalHeapSize, size, attrs)
+				if rmc.floats {
+					o.ObserveFloat64(rmc.totalHeapSizeFloat, float64(size), attrs)
+				}
+				return nil
+			}
+			cfg := currentConfig()
+			size := rmc.generators.value(totalHeapSize, cfg.RandomGenerators[totalHeapSize], cfg.TotalHeapSizeUpperBound)
+			o.ObserveInt64(rmc.totalHeapSize, size, attrs)
+			if rmc.floats {
+				sizeFloat := rmc.floatGenerators.floatValue(totalHeapSize, cfg.RandomGenerators[totalHeapSize], float64(cfg.TotalHeapSizeUpperBound))
+				o.ObserveFloat64(rmc.totalHeapSizeFloat, sizeFloat, attrs)
+			}
 
 			return nil
 		},
-		rmc.totalHeapSize,
+		rmc.observables(rmc.totalHeapSize, rmc.totalHeapSizeFloat)...,
 	); err != nil {
 		panic(err)
 	}
 }
 
 // updateThreadsActive updates ThreadsActive by a value between 0 and 10 in increments or decrements of 1 based on previous value.
-func (rmc *randomMetricCollector) updateThreadsActive(ctx context.Context, cfg Config) {
+// When a generator is configured, ThreadsActive follows its shape between 0 and ThreadsActiveUpperBound instead.
+func (rmc *randomMetricCollector) updateThreadsActive(ctx context.Context, cfg *Config) {
+	if g, ok := cfg.RandomGenerators[threadsActive]; ok {
+		target := rmc.generators.value(threadsActive, g, cfg.ThreadsActiveUpperBound)
+		rmc.addThreadsActive(ctx, target-threadCount)
+		threadCount = target
+		return
+	}
 	if threadsBool {
 		if threadCount < int64(cfg.ThreadsActiveUpperBound) {
-			rmc.threadsActive.Add(ctx, 1, randomMetricCommonLabels...)
+			rmc.addThreadsActive(ctx, 1)
 			threadCount++
 		} else {
 			threadsBool = false
@@ -158,7 +300,7 @@ func (rmc *randomMetricCollector) updateThreadsActive(ctx context.Context, cfg C
 
 	} else {
 		if threadCount > 0 {
-			rmc.threadsActive.Add(ctx, -1, randomMetricCommonLabels...)
+			rmc.addThreadsActive(ctx, -1)
 			threadCount--
 		} else {
 			threadsBool = true
@@ -166,3 +308,16 @@ func (rmc *randomMetricCollector) updateThreadsActive(ctx context.Context, cfg C
 		}
 	}
 }
+
+// attributes returns the attributes of the next recording of instrument, the common labels followed by any extra cardinality attributes.
+func (rmc *randomMetricCollector) attributes(instrument string) metric.MeasurementOption {
+	return metric.WithAttributes(rmc.cardinality.attributes(currentConfig(), instrument, rmc.labels)...)
+}
+
+// observables returns the instruments observed by a callback, leaving out the Float64 counterpart when it is not registered.
+func (rmc *randomMetricCollector) observables(instrument metric.Observable, floatInstrument metric.Observable) []metric.Observable {
+	if rmc.floats {
+		return []metric.Observable{instrument, floatInstrument}
+	}
+	return []metric.Observable{instrument}
+}
@@ -0,0 +1,148 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configChange is a live setting whose value changed on reload.
+type configChange struct {
+	key      string
+	oldValue string
+	newValue string
+}
+
+// WatchConfiguration reloads the configuration whenever the configuration file changes or SIGHUP is received, until ctx is done.
+// Only the live settings (TimeInterval, the Random* upper bounds and generators, the Cardinality* settings, the SampleApp* call settings, LeafUrls, AwsSdkCalls and the S3 object) are applied; other settings need a restart.
+// Metric instruments are kept, so cumulative values carry on across reloads.
+func WatchConfiguration(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// The directory is watched as editors and Kubernetes ConfigMaps replace the file rather than write to it.
+	// A ConfigMap update swaps the ..data symlink the file resolves through, so no event names the file itself:
+	// as viper.WatchConfig does, the file is also reloaded whenever the path it resolves to changes.
+	configFile := filepath.Clean(viper.ConfigFileUsed())
+	realConfigFile, _ := filepath.EvalSymlinks(configFile)
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reloadConfiguration(ctx, "SIGHUP")
+			case event := <-watcher.Events:
+				currentConfigFile, _ := filepath.EvalSymlinks(configFile)
+				written := filepath.Clean(event.Name) == configFile && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if written || (currentConfigFile != "" && currentConfigFile != realConfigFile) {
+					realConfigFile = currentConfigFile
+					reloadConfiguration(ctx, "file change")
+				}
+			case err := <-watcher.Errors:
+				fmt.Println(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadConfiguration re-reads the configuration and applies the live settings that changed.
+// An invalid configuration is reported and the current configuration is kept.
+func reloadConfiguration(ctx context.Context, trigger string) {
+	next, err := ReloadConfiguration()
+	if err != nil {
+		fmt.Println("Configuration not reloaded:", err)
+		return
+	}
+
+	cfg, changes := applyLiveSettings(currentConfig(), next)
+	if len(changes) == 0 {
+		return
+	}
+	liveConfig.Store(cfg)
+
+	_, span := tracer.Start(
+		ctx,
+		"reload-configuration",
+		trace.WithAttributes(traceCommonLabels...),
+		trace.WithAttributes(attribute.String("trigger", trigger)),
+	)
+	defer span.End()
+	for _, c := range changes {
+		fmt.Printf("Configuration reloaded (%s): %s changed from %s to %s\n", trigger, c.key, c.oldValue, c.newValue)
+		span.AddEvent("config.changed", trace.WithAttributes(
+			attribute.String("config.key", c.key),
+			attribute.String("config.old_value", c.oldValue),
+			attribute.String("config.new_value", c.newValue),
+		))
+	}
+}
+
+// applyLiveSettings returns a copy of current with the live settings taken from next, and the settings that changed.
+func applyLiveSettings(current, next *Config) (*Config, []configChange) {
+	cfg := *current
+	var changes []configChange
+	apply := func(key string, dst, src interface{}) {
+		oldValue, newValue := fmt.Sprint(dst), fmt.Sprint(src)
+		if oldValue != newValue {
+			changes = append(changes, configChange{key: key, oldValue: oldValue, newValue: newValue})
+		}
+	}
+
+	apply("TimeInterval", cfg.TimeInterval, next.TimeInterval)
+	apply("RandomTimeAliveIncrementer", cfg.TimeAliveIncrementer, next.TimeAliveIncrementer)
+	apply("RandomTotalHeapSizeUpperBound", cfg.TotalHeapSizeUpperBound, next.TotalHeapSizeUpperBound)
+	apply("RandomThreadsActiveUpperBound", cfg.ThreadsActiveUpperBound, next.ThreadsActiveUpperBound)
+	apply("RandomCpuUsageUpperBound", cfg.CpuUsageUpperBound, next.CpuUsageUpperBound)
+	apply("RandomGenerators", cfg.RandomGenerators, next.RandomGenerators)
+	apply("CardinalityAttributes", cfg.CardinalityAttributes, next.CardinalityAttributes)
+	apply("CardinalityValues", cfg.CardinalityValues, next.CardinalityValues)
+	apply("CardinalityMode", cfg.CardinalityMode, next.CardinalityMode)
+	apply("SampleAppPorts", cfg.SampleAppPorts, next.SampleAppPorts)
+	apply("SampleAppFanOut", cfg.SampleAppFanOut, next.SampleAppFanOut)
+	apply("SampleAppMaxDepth", cfg.SampleAppMaxDepth, next.SampleAppMaxDepth)
+	apply("SampleAppTimeout", cfg.SampleAppTimeout, next.SampleAppTimeout)
+	apply("LeafUrls", cfg.LeafUrls, next.LeafUrls)
+	apply("AwsSdkCalls", cfg.AwsSdkCalls, next.AwsSdkCalls)
+	apply("AwsS3Bucket", cfg.AwsS3Bucket, next.AwsS3Bucket)
+	apply("AwsS3Key", cfg.AwsS3Key, next.AwsS3Key)
+
+	cfg.TimeInterval = next.TimeInterval
+	cfg.TimeAliveIncrementer = next.TimeAliveIncrementer
+	cfg.TotalHeapSizeUpperBound = next.TotalHeapSizeUpperBound
+	cfg.ThreadsActiveUpperBound = next.ThreadsActiveUpperBound
+	cfg.CpuUsageUpperBound = next.CpuUsageUpperBound
+	cfg.RandomGenerators = next.RandomGenerators
+	cfg.CardinalityAttributes = next.CardinalityAttributes
+	cfg.CardinalityValues = next.CardinalityValues
+	cfg.CardinalityMode = next.CardinalityMode
+	cfg.SampleAppPorts = next.SampleAppPorts
+	cfg.SampleAppFanOut = next.SampleAppFanOut
+	cfg.SampleAppMaxDepth = next.SampleAppMaxDepth
+	cfg.SampleAppTimeout = next.SampleAppTimeout
+	cfg.LeafUrls = next.LeafUrls
+	cfg.AwsSdkCalls = next.AwsSdkCalls
+	cfg.AwsS3Bucket = next.AwsS3Bucket
+	cfg.AwsS3Key = next.AwsS3Key
+	return &cfg, changes
+}
@@ -3,42 +3,114 @@ package collection
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"sync/atomic"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/metric/instrument"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// HTTP server instruments of the semantic conventions, recorded when HttpSemconvMetrics is enabled.
+const (
+	httpServerDuration     = "http.server.duration"
+	httpServerRequestSize  = "http.server.request.size"
+	httpServerResponseSize = "http.server.response.size"
 )
 
 // requestBasedMetricCollector contains all the request based metric instruments.
 type requestBasedMetricCollector struct {
-	totalBytesSent   instrument.Int64Counter
-	totalApiRequests instrument.Int64ObservableCounter
-	latencyTime      instrument.Int64Histogram
-	config           Config
+	totalBytesSent   metric.Int64Counter
+	totalApiRequests metric.Int64ObservableCounter
+	latencyTime      metric.Int64Histogram
+	downstreamTime   metric.Int64Histogram
 	meter            metric.Meter
-	counter          int64
+	requests         *requestCounts
+	cardinality      *cardinality
+
+	// Float64 counterparts of the instruments, registered when FloatMetrics is enabled
+	floats                bool
+	totalBytesSentFloat   metric.Float64Counter
+	totalApiRequestsFloat metric.Float64ObservableCounter
+	latencyTimeFloat      metric.Float64Histogram
+	downstreamTimeFloat   metric.Float64Histogram
+
+	// HTTP server instruments of the semantic conventions, registered when HttpSemconvMetrics is enabled
+	semconv            bool
+	serverDuration     metric.Float64Histogram
+	serverRequestSize  metric.Int64Histogram
+	serverResponseSize metric.Int64Histogram
+}
+
+// requestCounts holds the number of requests served for each set of request attributes.
+type requestCounts struct {
+	mu     sync.Mutex
+	counts map[attribute.Set]int64
+}
+
+// add adds 1 to the count of the attribute set.
+func (rc *requestCounts) add(set attribute.Set) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.counts[set]++
+}
+
+// snapshot returns a copy of the counts.
+func (rc *requestCounts) snapshot() map[attribute.Set]int64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	counts := make(map[attribute.Set]int64, len(rc.counts))
+	for set, count := range rc.counts {
+		counts[set] = count
+	}
+	return counts
 }
 
-// AddApiRequest adds 1 to the rqmc counter
-func (rqmc *requestBasedMetricCollector) AddApiRequest() {
-	atomic.AddInt64(&rqmc.counter, 1)
+// responseRecorder records the status code and the number of bytes of the response written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
 }
 
-// GetApiRequest gets the rqmc counter
-func (rqmc *requestBasedMetricCollector) GetApiRequest() int {
-	return int(atomic.LoadInt64(&rqmc.counter))
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += int64(n)
+	return n, err
 }
 
 // NewRequestBasedMetricCollector returns a new type struct that holds and registers the 3 request based metric instruments used in the Go-Sample-App;
 // TotalBytesSent, TotalRequests, LatencyTime
-func NewRequestBasedMetricCollector(ctx context.Context, cfg Config, mp metric.MeterProvider) requestBasedMetricCollector {
+func NewRequestBasedMetricCollector(ctx context.Context, mp metric.MeterProvider) requestBasedMetricCollector {
 
-	rqmc := requestBasedMetricCollector{config: cfg}
+	cfg := currentConfig()
+	rqmc := requestBasedMetricCollector{
+		requests:    &requestCounts{counts: map[attribute.Set]int64{}},
+		cardinality: newCardinality(cfg.Seed, requestCardinalityStream),
+	}
 	rqmc.meter = mp.Meter("github.com/aws-otel-commnunity/sample-apps/go-sample-app/collection")
 	rqmc.registerTotalBytesSent()
 	rqmc.registerTotalRequests()
 	rqmc.registerLatencyTime()
+	rqmc.registerDownstreamLatencyTime()
+	if cfg.FloatMetrics {
+		rqmc.registerFloatInstruments()
+	}
+	if cfg.HttpSemconvMetrics {
+		rqmc.registerSemconvInstruments()
+	}
 	return rqmc
 }
 
@@ -46,8 +118,8 @@ func NewRequestBasedMetricCollector(ctx context.Context, cfg Config, mp metric.M
 func (rqmc *requestBasedMetricCollector) registerTotalBytesSent() {
 	totalBytesSentMetric, err := rqmc.meter.Int64Counter(
 		totalBytesSent+testingId,
-		instrument.WithDescription("Keeps a sum of the total amount of bytes sent while the application is alive"),
-		instrument.WithUnit("By"),
+		metric.WithDescription("Keeps a sum of the total amount of bytes sent while the application is alive"),
+		metric.WithUnit("By"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -59,8 +131,8 @@ func (rqmc *requestBasedMetricCollector) registerTotalBytesSent() {
 func (rqmc *requestBasedMetricCollector) registerTotalRequests() {
 	totalApiRequestsMetric, err := rqmc.meter.Int64ObservableCounter(
 		totalApiRequests+testingId,
-		instrument.WithDescription("Increments by one every time a sampleapp endpoint is used"),
-		instrument.WithUnit("1"),
+		metric.WithDescription("Increments by one every time a sampleapp endpoint is used"),
+		metric.WithUnit("1"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -72,8 +144,8 @@ func (rqmc *requestBasedMetricCollector) registerTotalRequests() {
 func (rqmc *requestBasedMetricCollector) registerLatencyTime() {
 	latencyTimeMetric, err := rqmc.meter.Int64Histogram(
 		latencyTime+testingId,
-		instrument.WithDescription("Measures latency time in buckets of 100 300 and 500"),
-		instrument.WithUnit("ms"),
+		metric.WithDescription("Measures latency time in buckets of 100 300 and 500"),
+		metric.WithUnit("ms"),
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -81,31 +153,204 @@ func (rqmc *requestBasedMetricCollector) registerLatencyTime() {
 	rqmc.latencyTime = latencyTimeMetric
 }
 
+// registerDownstreamLatencyTime registers a Synchronous histogram called DownstreamLatencyTime.
+func (rqmc *requestBasedMetricCollector) registerDownstreamLatencyTime() {
+	downstreamLatencyTimeMetric, err := rqmc.meter.Int64Histogram(
+		downstreamLatencyTime+testingId,
+		metric.WithDescription("Measures the latency time of the calls made to downstream sample apps and leaf URLs"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		fmt.Println(err)
+	}
+	rqmc.downstreamTime = downstreamLatencyTimeMetric
+}
+
+// registerFloatInstruments registers the Float64 counterparts of TotalBytesSent, TotalApiRequests, LatencyTime and DownstreamLatencyTime.
+func (rqmc *requestBasedMetricCollector) registerFloatInstruments() {
+	var err error
+	rqmc.totalBytesSentFloat, err = rqmc.meter.Float64Counter(
+		totalBytesSent+floatSuffix+testingId,
+		metric.WithDescription("Keeps a sum of the total amount of bytes sent while the application is alive"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.totalApiRequestsFloat, err = rqmc.meter.Float64ObservableCounter(
+		totalApiRequests+floatSuffix+testingId,
+		metric.WithDescription("Increments by one every time a sampleapp endpoint is used"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.latencyTimeFloat, err = rqmc.meter.Float64Histogram(
+		latencyTime+floatSuffix+testingId,
+		metric.WithDescription("Measures latency time in buckets of 100 300 and 500"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.downstreamTimeFloat, err = rqmc.meter.Float64Histogram(
+		downstreamLatencyTime+floatSuffix+testingId,
+		metric.WithDescription("Measures the latency time of the calls made to downstream sample apps and leaf URLs"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.floats = true
+}
+
+// registerSemconvInstruments registers the HTTP server duration, request size and response size histograms of the semantic conventions.
+func (rqmc *requestBasedMetricCollector) registerSemconvInstruments() {
+	var err error
+	rqmc.serverDuration, err = rqmc.meter.Float64Histogram(
+		httpServerDuration,
+		metric.WithDescription("Measures the duration of inbound HTTP requests"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.serverRequestSize, err = rqmc.meter.Int64Histogram(
+		httpServerRequestSize,
+		metric.WithDescription("Measures the size of HTTP request messages"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.serverResponseSize, err = rqmc.meter.Int64Histogram(
+		httpServerResponseSize,
+		metric.WithDescription("Measures the size of HTTP response messages"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rqmc.semconv = true
+}
+
 // StartTotalRequestCallBack starts the callback for the TotalApiRequests.
 func (rqmc *requestBasedMetricCollector) StartTotalRequestCallback() {
 	if _, err := rqmc.meter.RegisterCallback(
 		// SDK periodically calls this function to collect data.
 		func(ctx context.Context, o metric.Observer) error {
-			o.ObserveInt64(rqmc.totalApiRequests, int64(rqmc.GetApiRequest()), requestMetricCommonLabels...)
+			for set, count := range rqmc.requests.snapshot() {
+				o.ObserveInt64(rqmc.totalApiRequests, count, metric.WithAttributeSet(set))
+				if rqmc.floats {
+					o.ObserveFloat64(rqmc.totalApiRequestsFloat, float64(count), metric.WithAttributeSet(set))
+				}
+			}
 
 			return nil
 		},
-		rqmc.totalApiRequests,
+		rqmc.observables()...,
 	); err != nil {
 		panic(err)
 	}
 }
 
-// UpdateTotalBytesSent updates TotalBytesSent with a value between 0 and 1024
-func (rqmc *requestBasedMetricCollector) UpdateTotalBytesSent(ctx context.Context) {
-	min := 0
-	max := 1024
-	rqmc.totalBytesSent.Add(ctx, int64(rand.Intn(max-min)+min), requestMetricCommonLabels...)
+// Middleware measures every request served by the router: it counts the request in TotalApiRequests, adds the bytes of the
+// response to TotalBytesSent and records the time taken by the handler, including its downstream calls, in LatencyTime.
+// The measurements carry the method, route and status code of the request.
+func (rqmc *requestBasedMetricCollector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rr := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rr, r)
+		elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+		if rr.status == 0 {
+			rr.status = http.StatusOK
+		}
+
+		ctx := r.Context()
+		route := requestRoute(r)
+		attrs := append([]attribute.KeyValue{}, requestMetricCommonLabels...)
+		attrs = append(attrs, semconv.HTTPMethod(r.Method), semconv.HTTPRoute(route), semconv.HTTPStatusCode(rr.status))
+		attrs = rqmc.cardinality.attributes(currentConfig(), totalApiRequests, attrs)
+		set := attribute.NewSet(attrs...)
+
+		rqmc.requests.add(set)
+		rqmc.totalBytesSent.Add(ctx, rr.bytes, metric.WithAttributeSet(set))
+		rqmc.latencyTime.Record(ctx, int64(elapsed), metric.WithAttributeSet(set))
+		if rqmc.floats {
+			rqmc.totalBytesSentFloat.Add(ctx, float64(rr.bytes), metric.WithAttributeSet(set))
+			rqmc.latencyTimeFloat.Record(ctx, elapsed, metric.WithAttributeSet(set))
+		}
+		if rqmc.semconv {
+			semconvAttrs := append([]attribute.KeyValue{}, requestMetricCommonLabels...)
+			semconvSet := metric.WithAttributes(append(semconvAttrs,
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPSchemeHTTP,
+				semconv.HTTPRoute(route),
+				semconv.HTTPStatusCode(rr.status),
+			)...)
+			rqmc.serverDuration.Record(ctx, elapsed, semconvSet)
+			if r.ContentLength >= 0 {
+				rqmc.serverRequestSize.Record(ctx, r.ContentLength, semconvSet)
+			}
+			rqmc.serverResponseSize.Record(ctx, rr.bytes, semconvSet)
+		}
+	})
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
 }
 
-// UpdateLatencyTime updates LatencyTime adds an aditional value between 0 and 512 to the histogram distribution.
-func (rqmc *requestBasedMetricCollector) UpdateLatencyTime(ctx context.Context) {
-	min := 0
-	max := 512
-	rqmc.latencyTime.Record(ctx, int64(rand.Intn(max-min)+min), requestMetricCommonLabels...)
+// Transport returns a http.RoundTripper measuring in DownstreamLatencyTime the time taken by the calls made through base
+// to downstream sample apps and leaf URLs, failed calls included. The measurements carry the method, the route of the
+// request being served, the host called and the status code of the response when there is one.
+func (rqmc *requestBasedMetricCollector) Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		res, err := base.RoundTrip(req)
+		elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+
+		// The outgoing request carries the context of the request being served, and with it its route
+		attrs := append([]attribute.KeyValue{}, requestMetricCommonLabels...)
+		attrs = append(attrs, semconv.HTTPMethod(req.Method), semconv.HTTPRoute(requestRoute(req)), semconv.NetPeerName(req.URL.Hostname()))
+		if err == nil {
+			attrs = append(attrs, semconv.HTTPStatusCode(res.StatusCode))
+		}
+		set := metric.WithAttributes(attrs...)
+
+		rqmc.downstreamTime.Record(req.Context(), int64(elapsed), set)
+		if rqmc.floats {
+			rqmc.downstreamTimeFloat.Record(req.Context(), elapsed, set)
+		}
+		return res, err
+	})
+}
+
+// requestRoute returns the path template of the route matching r, or its path when no route matched.
+func requestRoute(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// observables returns the instruments observed by the TotalApiRequests callback, leaving out the Float64 counterpart when it is not registered.
+func (rqmc *requestBasedMetricCollector) observables() []metric.Observable {
+	if rqmc.floats {
+		return []metric.Observable{rqmc.totalApiRequests, rqmc.totalApiRequestsFloat}
+	}
+	return []metric.Observable{rqmc.totalApiRequests}
 }
@@ -0,0 +1,120 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	goruntime "runtime"
+	runtimemetrics "runtime/metrics"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"go.opentelemetry.io/contrib/instrumentation/host"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Values accepted by MetricsSource.
+const (
+	metricsSourceRandom  = "random"
+	metricsSourceRuntime = "runtime"
+)
+
+// Go runtime metrics adding up to the memory mapped for the heap.
+var heapMetrics = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/heap/free:bytes",
+	"/memory/classes/heap/released:bytes",
+}
+
+var runtimeMetricCommonLabels = []attribute.KeyValue{
+	attribute.String("signal", "metric"),
+	attribute.String("language", serviceName),
+	attribute.String("metricType", "runtime"),
+}
+
+// runtimeSource observes the process in place of random values when MetricsSource is runtime.
+type runtimeSource struct {
+	process    *process.Process
+	lastTick   time.Time
+	goroutines int64
+}
+
+// newRuntimeSource returns a runtimeSource for the current process.
+func newRuntimeSource() (*runtimeSource, error) {
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	// The first reading only sets the baseline for the CPU usage of the next one
+	p.Percent(0)
+	return &runtimeSource{process: p, lastTick: time.Now()}, nil
+}
+
+// elapsed returns the time in milliseconds since the previous call.
+func (rs *runtimeSource) elapsed() int64 {
+	now := time.Now()
+	ms := now.Sub(rs.lastTick).Milliseconds()
+	rs.lastTick = rs.lastTick.Add(time.Duration(ms) * time.Millisecond)
+	return ms
+}
+
+// goroutineDelta returns the change in the number of goroutines since the previous call.
+func (rs *runtimeSource) goroutineDelta() int64 {
+	goroutines := int64(goruntime.NumGoroutine())
+	delta := goroutines - rs.goroutines
+	rs.goroutines = goroutines
+	return delta
+}
+
+// cpuUsage returns the CPU used by the process since the previous call, as a percentage of all CPUs.
+func (rs *runtimeSource) cpuUsage() (float64, error) {
+	percent, err := rs.process.Percent(0)
+	if err != nil {
+		return 0, err
+	}
+	return percent / float64(goruntime.NumCPU()), nil
+}
+
+// heapSize returns the bytes of memory mapped for the Go heap.
+func heapSize() int64 {
+	samples := make([]runtimemetrics.Sample, len(heapMetrics))
+	for i, name := range heapMetrics {
+		samples[i].Name = name
+	}
+	runtimemetrics.Read(samples)
+	var total uint64
+	for _, s := range samples {
+		if s.Value.Kind() == runtimemetrics.KindUint64 {
+			total += s.Value.Uint64()
+		}
+	}
+	return int64(total)
+}
+
+// startContribMetrics starts the OpenTelemetry contrib runtime and host instrumentation enabled in cfg.
+func startContribMetrics(mp metric.MeterProvider, cfg *Config) {
+	if cfg.ContribRuntimeMetrics {
+		if err := runtime.Start(
+			runtime.WithMeterProvider(mp),
+			runtime.WithMinimumReadMemStatsInterval(time.Second*time.Duration(cfg.TimeInterval)),
+		); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if cfg.ContribHostMetrics {
+		if err := host.Start(host.WithMeterProvider(mp)); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// updateRuntime adds the time elapsed to TimeAlive and the change in goroutines to ThreadsActive.
+func (rmc *randomMetricCollector) updateRuntime(ctx context.Context) {
+	rmc.addTimeAlive(ctx, rmc.runtime.elapsed())
+	if delta := rmc.runtime.goroutineDelta(); delta != 0 {
+		rmc.addThreadsActive(ctx, delta)
+	}
+}
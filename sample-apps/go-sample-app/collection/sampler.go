@@ -0,0 +1,58 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	sampler "go.opentelemetry.io/contrib/samplers/aws/xray"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Samplers accepted by TracesSampler (OTEL_TRACES_SAMPLER).
+const (
+	samplerAlwaysOn                = "always_on"
+	samplerAlwaysOff               = "always_off"
+	samplerTraceIdRatio            = "traceidratio"
+	samplerParentBasedAlwaysOn     = "parentbased_always_on"
+	samplerParentBasedAlwaysOff    = "parentbased_always_off"
+	samplerParentBasedTraceIdRatio = "parentbased_traceidratio"
+	samplerXray                    = "xray"
+	samplerXrayRemote              = "xray-remote"
+)
+
+// newSampler creates the sampler selected by cfg.TracesSampler.
+// TracesSamplerArg is the sampling ratio for the traceidratio samplers and is ignored by the others.
+func newSampler(ctx context.Context, cfg *Config) (sdktrace.Sampler, error) {
+	switch cfg.TracesSampler {
+	case samplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case samplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case samplerTraceIdRatio:
+		return sdktrace.TraceIDRatioBased(cfg.TracesSamplerArg), nil
+	case samplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case samplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case samplerParentBasedTraceIdRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracesSamplerArg)), nil
+	case samplerXray, samplerXrayRemote:
+		return newXrayRemoteSampler(ctx, cfg)
+	}
+	return nil, fmt.Errorf("unsupported traces sampler %q", cfg.TracesSampler)
+}
+
+// newXrayRemoteSampler creates an AWS X-Ray remote sampler which polls sampling rules from XraySamplerEndpoint,
+// usually the ADOT Collector awsproxy extension or the X-Ray daemon.
+func newXrayRemoteSampler(ctx context.Context, cfg *Config) (sdktrace.Sampler, error) {
+	endpoint, err := url.Parse(cfg.XraySamplerEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return sampler.NewRemoteSampler(ctx, "go-sample-app", "",
+		sampler.WithEndpoint(*endpoint),
+		sampler.WithSamplingRulesPollingInterval(time.Second*time.Duration(cfg.XraySamplingRulesPollingInterval)),
+	)
+}
@@ -0,0 +1,102 @@
+package collection
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// Streams hashed with Seed so each collector draws from its own sequence of values.
+const (
+	randomMetricsStream = 0
+	customMetricsStream = 2
+	// The Float64 counterparts draw their own values, so enabling FloatMetrics leaves the Int64 values unchanged
+	randomFloatMetricsStream = 3
+	randomCardinalityStream  = 4
+	requestCardinalityStream = 5
+	loadgenStream            = 6
+)
+
+type seedResponse struct {
+	Seed int64 `json:"seed"`
+}
+
+// lockedRand is a *rand.Rand which is safe to use from several goroutines, like request handlers.
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newLockedRand returns a lockedRand drawing the sequence of values given by seed, stream and instrument.
+// Each instrument draws from its own sequence, so the values it gets do not depend on the timing of the goroutines recording other instruments.
+func newLockedRand(seed int64, stream int64, instrument string) *lockedRand {
+	return &lockedRand{rand: rand.New(rand.NewSource(streamSeed(seed, stream, instrument)))}
+}
+
+// streamSeed hashes seed, stream and instrument into the seed of their sequence of values,
+// so the sequences of different seeds do not overlap as they would with an offset added to the seed.
+func streamSeed(seed int64, stream int64, instrument string) int64 {
+	h := fnv.New64a()
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(seed))
+	binary.BigEndian.PutUint64(b[8:], uint64(stream))
+	h.Write(b[:])
+	h.Write([]byte(instrument))
+	return int64(h.Sum64())
+}
+
+// lockedRands holds a lockedRand per instrument, created on first use.
+type lockedRands struct {
+	seed   int64
+	stream int64
+	mu     sync.Mutex
+	rands  map[string]*lockedRand
+}
+
+// newLockedRands returns the lockedRands of the instruments of stream.
+func newLockedRands(seed int64, stream int64) *lockedRands {
+	return &lockedRands{seed: seed, stream: stream, rands: map[string]*lockedRand{}}
+}
+
+// of returns the lockedRand of instrument.
+func (lr *lockedRands) of(instrument string) *lockedRand {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	r, ok := lr.rands[instrument]
+	if !ok {
+		r = newLockedRand(lr.seed, lr.stream, instrument)
+		lr.rands[instrument] = r
+	}
+	return r
+}
+
+// Intn returns a value in [0, n).
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Intn(n)
+}
+
+// Float64 returns a value in [0.0, 1.0).
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Float64()
+}
+
+// NormFloat64 returns a normally distributed value with mean 0 and standard deviation 1.
+func (r *lockedRand) NormFloat64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.NormFloat64()
+}
+
+// Seed responds with the seed the random metric values are generated from.
+func Seed(w http.ResponseWriter, r *http.Request) {
+	payload, _ := json.Marshal(seedResponse{Seed: currentConfig().Seed})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
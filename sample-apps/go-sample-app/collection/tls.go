@@ -0,0 +1,45 @@
+package collection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// newTLSConfig builds the TLS configuration shared by the OTLP trace and metric exporters.
+// It returns nil when TLS is disabled, in which case the exporters connect insecurely.
+// Setting both TlsCertFile and TlsKeyFile enables mutual TLS.
+func newTLSConfig(cfg *Config) (*tls.Config, error) {
+	if !cfg.TlsEnabled {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.TlsServerName,
+		InsecureSkipVerify: cfg.TlsInsecureSkipVerify,
+	}
+
+	// Without a CA bundle the system root certificates are used.
+	if cfg.TlsCaFile != "" {
+		pem, err := os.ReadFile(cfg.TlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TlsCaFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.TlsCertFile != "" || cfg.TlsKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TlsCertFile, cfg.TlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
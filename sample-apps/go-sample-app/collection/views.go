@@ -0,0 +1,117 @@
+package collection
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Aggregations accepted by MetricView.Aggregation.
+const (
+	aggregationDefault                 = "default"
+	aggregationDrop                    = "drop"
+	aggregationSum                     = "sum"
+	aggregationLastValue               = "last_value"
+	aggregationExplicitBucketHistogram = "explicit_bucket_histogram"
+	aggregationExponentialHistogram    = "exponential_histogram"
+)
+
+// Temporalities accepted by MetricsTemporality (OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE).
+const (
+	temporalityCumulative = "cumulative"
+	temporalityDelta      = "delta"
+	temporalityLowMemory  = "lowmemory"
+)
+
+// newViews creates a metric view for every MetricView in cfg.MetricViews.
+func newViews(cfg *Config) ([]metric.View, error) {
+	var views []metric.View
+	for _, v := range cfg.MetricViews {
+		view, err := newView(v)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// newView creates a metric view that applies the rename, aggregation and attribute filter of v to the matching instruments.
+// InstrumentName may contain the * and ? wildcards, and is matched against names that include the INSTANCE_ID suffix.
+func newView(v MetricView) (metric.View, error) {
+	if v.InstrumentName == "" {
+		return nil, fmt.Errorf("metric view is missing an InstrumentName")
+	}
+	if v.Rename != "" && strings.ContainsAny(v.InstrumentName, "*?") {
+		return nil, fmt.Errorf("metric view %q cannot rename instruments matched by a wildcard", v.InstrumentName)
+	}
+
+	stream := metric.Stream{Name: v.Rename}
+	switch v.Aggregation {
+	case aggregationDefault, "":
+	case aggregationDrop:
+		stream.Aggregation = metric.AggregationDrop{}
+	case aggregationSum:
+		stream.Aggregation = metric.AggregationSum{}
+	case aggregationLastValue:
+		stream.Aggregation = metric.AggregationLastValue{}
+	case aggregationExplicitBucketHistogram:
+		for i := 1; i < len(v.Boundaries); i++ {
+			if v.Boundaries[i] <= v.Boundaries[i-1] {
+				return nil, fmt.Errorf("metric view %q boundaries must be strictly increasing", v.InstrumentName)
+			}
+		}
+		stream.Aggregation = metric.AggregationExplicitBucketHistogram{Boundaries: v.Boundaries}
+	case aggregationExponentialHistogram:
+		maxSize, maxScale := v.MaxSize, v.MaxScale
+		if maxSize == 0 {
+			maxSize = 160
+		}
+		if maxScale == 0 {
+			maxScale = 20
+		}
+		stream.Aggregation = metric.AggregationBase2ExponentialHistogram{MaxSize: maxSize, MaxScale: maxScale}
+	default:
+		return nil, fmt.Errorf("metric view %q has unsupported aggregation %q", v.InstrumentName, v.Aggregation)
+	}
+	// Only the listed attribute keys are kept when an allow list is given.
+	if len(v.AttributeKeys) > 0 {
+		keys := make([]attribute.Key, 0, len(v.AttributeKeys))
+		for _, k := range v.AttributeKeys {
+			keys = append(keys, attribute.Key(k))
+		}
+		stream.AttributeFilter = attribute.NewAllowKeysFilter(keys...)
+	}
+
+	return metric.NewView(metric.Instrument{Name: v.InstrumentName + testingId}, stream), nil
+}
+
+// newTemporalitySelector returns the temporality selector for cfg.MetricsTemporality.
+// delta reports monotonic instruments as deltas and lowmemory only synchronous counters and histograms,
+// following the OTLP exporter temporality preferences.
+func newTemporalitySelector(cfg *Config) (metric.TemporalitySelector, error) {
+	switch cfg.MetricsTemporality {
+	case temporalityCumulative, "":
+		return metric.DefaultTemporalitySelector, nil
+	case temporalityDelta:
+		return func(kind metric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case metric.InstrumentKindCounter, metric.InstrumentKindObservableCounter, metric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	case temporalityLowMemory:
+		return func(kind metric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case metric.InstrumentKindCounter, metric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported metrics temporality %q", cfg.MetricsTemporality)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/aws-otel-commnunity/sample-apps/go-sample-app/collection"
@@ -20,51 +22,100 @@ import (
 func main() {
 	ctx := context.Background()
 
-	// The seed for 'random' values used in this applicaiton
-	rand.Seed(time.Now().UnixNano())
+	// The loadgen subcommand generates traffic to a sample app instead of serving requests
+	args := os.Args[1:]
+	loadgen := len(args) > 0 && args[0] == "loadgen"
+	if loadgen {
+		args = args[1:]
+	}
+
+	// Reads the configuration from config.yaml, the environment and the command line
+	cfg, err := collection.GetConfiguration(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The seed for 'random' values used in this applicaiton, taken from the current time unless Seed is set
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	fmt.Println("Seed:", cfg.Seed)
 
 	// Client starts
-	shutdown, err := collection.StartClient(ctx)
+	shutdown, err := collection.StartClient(ctx, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer shutdown(ctx)
+
+	// Cancelled on SIGINT or SIGTERM to stop generating metrics and serving requests
+	signalCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if loadgen {
+		collection.RunLoadGenerator(signalCtx, cfg)
+		shutdownCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(cfg.ShutdownTimeout))
+		defer cancel()
+		if err := shutdown(shutdownCtx); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
 
 	// (Metric related) Creates and configures random based metrics based on a configuration file (config.yaml).
 	mp := otel.GetMeterProvider()
-	cfg := collection.GetConfiguration()
 
 	// (Metric related) Starts request based metric and registers necessary callbacks
 	rmc := collection.NewRandomMetricCollector(mp)
-	rmc.RegisterMetricsClient(ctx, *cfg)
-	rqmc := collection.NewRequestBasedMetricCollector(ctx, *cfg, mp)
+	rmc.RegisterMetricsClient(signalCtx)
+	rqmc := collection.NewRequestBasedMetricCollector(ctx, mp)
 	rqmc.StartTotalRequestCallback()
 
-	s3Client, err := collection.NewS3Client()
-	if err != nil {
+	// (Metric related) Creates the instruments declared in the Metrics section of the configuration
+	cmc := collection.NewCustomMetricCollector(mp)
+	cmc.RegisterMetricsClient(signalCtx)
+
+	// Applies changes to the live settings in the configuration file or on SIGHUP
+	if err := collection.WatchConfiguration(signalCtx); err != nil {
 		fmt.Println(err)
 	}
+
+	awsClient, err := collection.NewAwsClient(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 	// Creates a router, client and web server with several endpoints
 	r := mux.NewRouter()
 	client := http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		// (Metric related) Measures the downstream calls made by the endpoints
+		Transport: otelhttp.NewTransport(rqmc.Transport(http.DefaultTransport)),
 	}
 
 	r.Use(otelmux.Middleware("Go-Sampleapp-Server"))
 
 	// Three endpoints
-	r.HandleFunc("/aws-sdk-call", func(w http.ResponseWriter, r *http.Request) {
-		collection.AwsSdkCall(w, r, &rqmc, s3Client)
+	endpoints := r.NewRoute().Subrouter()
+	// (Metric related) Measures the requests served by the three endpoints only, so /echo calls made by
+	// /outgoing-http-call and /outgoing-sampleapp are not counted twice
+	endpoints.Use(rqmc.Middleware)
+
+	endpoints.HandleFunc("/aws-sdk-call", func(w http.ResponseWriter, r *http.Request) {
+		collection.AwsSdkCall(w, r, awsClient)
 	})
 
-	r.HandleFunc("/outgoing-http-call", func(w http.ResponseWriter, r *http.Request) {
-		collection.OutgoingHttpCall(w, r, client, &rqmc)
+	endpoints.HandleFunc("/outgoing-http-call", func(w http.ResponseWriter, r *http.Request) {
+		collection.OutgoingHttpCall(w, r, client)
 	})
 
-	r.HandleFunc("/outgoing-sampleapp", func(w http.ResponseWriter, r *http.Request) {
-		collection.OutgoingSampleApp(w, r, client, &rqmc)
+	endpoints.HandleFunc("/outgoing-sampleapp", func(w http.ResponseWriter, r *http.Request) {
+		collection.OutgoingSampleApp(w, r, client)
 	})
 
+	// Built-in leaf target for offline use
+	r.HandleFunc("/echo", collection.Echo)
+
+	// Reports the seed of the random metric values
+	r.HandleFunc("/seed", collection.Seed)
+
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -75,6 +126,22 @@ func main() {
 		Addr: net.JoinHostPort(cfg.Host, cfg.Port),
 	}
 	fmt.Println("Listening on port:", srv.Addr)
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-signalCtx.Done()
+	fmt.Println("Shutting down")
 
+	// Drains in-flight requests, then flushes any buffered spans and metrics, all within ShutdownTimeout
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Println(err)
+	}
+	if err := shutdown(shutdownCtx); err != nil {
+		fmt.Println(err)
+	}
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// floatList is a flag.Value holding a comma separated list of floats, e.g. "0.1,0.5,1".
+type floatList []float64
+
+func (l *floatList) String() string {
+	values := make([]string, len(*l))
+	for i, v := range *l {
+		values[i] = formatFloat(v)
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *floatList) Set(s string) error {
+	*l = nil
+	if s == "" {
+		return nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// objectives is a flag.Value holding summary quantiles and their absolute errors, e.g. "0.5:0.05,0.99:0.001".
+type objectives map[float64]float64
+
+func (o *objectives) String() string {
+	quantiles := make([]float64, 0, len(*o))
+	for q := range *o {
+		quantiles = append(quantiles, q)
+	}
+	sort.Float64s(quantiles)
+	pairs := make([]string, len(quantiles))
+	for i, q := range quantiles {
+		pairs[i] = formatFloat(q) + ":" + formatFloat((*o)[q])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (o *objectives) Set(s string) error {
+	*o = objectives{}
+	if s == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		quantile, tolerance, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("objective %q is not quantile:error", pair)
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(quantile), 64)
+		if err != nil {
+			return err
+		}
+		e, err := strconv.ParseFloat(strings.TrimSpace(tolerance), 64)
+		if err != nil {
+			return err
+		}
+		(*o)[q] = e
+	}
+	return nil
+}
+
+// histogramBuckets returns the classic buckets of the histograms: HistogramBuckets with the explicit generator, or
+// HistogramBucketCount buckets from HistogramBucketStart, HistogramBucketWidth apart with the linear generator
+// or each HistogramBucketFactor times the previous one with the exponential generator.
+func (conf *Config) histogramBuckets() ([]float64, error) {
+	switch conf.HistogramBucketGenerator {
+	case "explicit":
+		if !sort.Float64sAreSorted(conf.HistogramBuckets) {
+			return nil, errors.New("Histogram buckets must be in increasing order")
+		}
+		for i := 1; i < len(conf.HistogramBuckets); i++ {
+			if conf.HistogramBuckets[i] == conf.HistogramBuckets[i-1] {
+				return nil, errors.New("Histogram buckets must be distinct")
+			}
+		}
+		return conf.HistogramBuckets, nil
+	case "linear":
+		if conf.HistogramBucketCount < 1 || conf.HistogramBucketWidth <= 0 {
+			return nil, errors.New("Linear histogram buckets require a count >= 1 and a width > 0")
+		}
+		return prometheus.LinearBuckets(conf.HistogramBucketStart, conf.HistogramBucketWidth, conf.HistogramBucketCount), nil
+	case "exponential":
+		if conf.HistogramBucketCount < 1 || conf.HistogramBucketStart <= 0 || conf.HistogramBucketFactor <= 1 {
+			return nil, errors.New("Exponential histogram buckets require a count >= 1, a start > 0 and a factor > 1")
+		}
+		return prometheus.ExponentialBuckets(conf.HistogramBucketStart, conf.HistogramBucketFactor, conf.HistogramBucketCount), nil
+	default:
+		return nil, errors.New("Invalid histogram bucket generator")
+	}
+}
+
+// validateSummary checks the summary objectives, MaxAge and AgeBuckets.
+func (conf *Config) validateSummary() error {
+	for q, e := range conf.SummaryObjectives {
+		if q < 0 || q > 1 || e < 0 || e > 1 {
+			return errors.New("Summary objective quantiles and errors must be between 0 and 1")
+		}
+	}
+	if conf.SummaryMaxAge <= 0 || conf.SummaryAgeBuckets <= 0 {
+		return errors.New("Summary max age and age buckets must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Accept headers forcing each exposition format; with "auto" the format is negotiated with the scraper.
+var expositionFormats = map[string]expfmt.Format{
+	"auto":        "",
+	"text":        expfmt.NewFormat(expfmt.TypeTextPlain),
+	"openmetrics": expfmt.NewFormat(expfmt.TypeOpenMetrics),
+	"protobuf":    expfmt.NewFormat(expfmt.TypeProtoDelim),
+}
+
+// metricsHandler returns the /metrics handler. It serves the text, OpenMetrics or delimited protobuf format
+// negotiated from the Accept header of the scrape, unless conf.ExpositionFormat forces one of them.
+// Exemplars and _created series are only exposed in the OpenMetrics format, native histograms only in the protobuf format.
+func metricsHandler(conf *Config) http.Handler {
+	handler := promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{
+		EnableOpenMetrics:                   conf.OpenMetrics,
+		EnableOpenMetricsTextCreatedSamples: conf.CreatedSeries,
+	})
+	format := expositionFormats[conf.ExpositionFormat]
+	if format == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept", string(format))
+		handler.ServeHTTP(w, r)
+	})
+}
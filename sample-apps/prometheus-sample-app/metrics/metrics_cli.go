@@ -13,7 +13,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/yaml.v3"
 )
 
@@ -24,13 +23,41 @@ var (
 )
 
 type Config struct {
-	Address        string `yaml:"Address"`
-	Type           string `yaml:"Type"`
-	MetricsCount   int    `yaml:"MetricsCount"`
-	LabelsCount    int    `yaml:"LabelsCount"`
-	DataPointCount int    `yaml:"DataPointCount"`
-	Frequency      int    `yaml:"Frequency"`
-	Random         bool   `yaml:"Random"`
+	Address          string `yaml:"Address"`
+	Type             string `yaml:"Type"`
+	MetricsCount     int    `yaml:"MetricsCount"`
+	LabelsCount      int    `yaml:"LabelsCount"`
+	DataPointCount   int    `yaml:"DataPointCount"`
+	Frequency        int    `yaml:"Frequency"`
+	Random           bool   `yaml:"Random"`
+	OpenMetrics      bool   `yaml:"OpenMetrics"`
+	ExpositionFormat string `yaml:"ExpositionFormat"`
+	CreatedSeries    bool   `yaml:"CreatedSeries"`
+	Exemplars        bool   `yaml:"Exemplars"`
+	Tracing          bool   `yaml:"Tracing"`
+
+	HistogramMode                  string  `yaml:"HistogramMode"`
+	NativeHistogramBucketFactor    float64 `yaml:"NativeHistogramBucketFactor"`
+	NativeHistogramMaxBucketNumber int     `yaml:"NativeHistogramMaxBucketNumber"`
+	NativeHistogramZeroThreshold   float64 `yaml:"NativeHistogramZeroThreshold"`
+
+	HistogramBucketGenerator string              `yaml:"HistogramBucketGenerator"`
+	HistogramBuckets         []float64           `yaml:"HistogramBuckets"`
+	HistogramBucketStart     float64             `yaml:"HistogramBucketStart"`
+	HistogramBucketWidth     float64             `yaml:"HistogramBucketWidth"`
+	HistogramBucketFactor    float64             `yaml:"HistogramBucketFactor"`
+	HistogramBucketCount     int                 `yaml:"HistogramBucketCount"`
+	SummaryObjectives        map[float64]float64 `yaml:"SummaryObjectives"`
+	SummaryMaxAge            int                 `yaml:"SummaryMaxAge"`
+	SummaryAgeBuckets        int                 `yaml:"SummaryAgeBuckets"`
+
+	Mode                   string            `yaml:"Mode"`
+	RemoteWriteURL         string            `yaml:"RemoteWriteURL"`
+	RemoteWriteBatchSize   int               `yaml:"RemoteWriteBatchSize"`
+	RemoteWriteRetries     int               `yaml:"RemoteWriteRetries"`
+	RemoteWriteTimeout     int               `yaml:"RemoteWriteTimeout"`
+	RemoteWriteSigV4Region string            `yaml:"RemoteWriteSigV4Region"`
+	RemoteWriteHeaders     map[string]string `yaml:"RemoteWriteHeaders"`
 }
 
 /*
@@ -40,6 +67,21 @@ type Config struct {
 	defaultRand valid values should be boolean
 	defaultLabelsCount valid values should be >= 0
 	defaultDataPointCount valid values should be > 0
+	defaultOpenMetrics, defaultCreatedSeries, defaultExemplars and defaultTracing valid values should be boolean
+	defaultExpositionFormat valid values include - "auto" "text" "openmetrics" "protobuf"
+	defaultHistogramMode valid values include - "classic" "native" "both"
+	defaultNativeHistogramBucketFactor valid values should be > 1
+	defaultNativeHistogramMaxBucketNumber valid values should be >= 0, 0 for no limit
+	defaultNativeHistogramZeroThreshold valid values should be >= 0, 0 for the client library default
+	defaultHistogramBucketGenerator valid values include - "explicit" "linear" "exponential"
+	defaultHistogramBuckets valid values should be in increasing order
+	defaultHistogramBucketWidth and defaultHistogramBucketCount valid values should be > 0
+	defaultHistogramBucketStart valid values should be > 0 and defaultHistogramBucketFactor > 1 for exponential buckets
+	defaultSummaryObjectives valid values should map quantiles between 0 and 1 to errors between 0 and 1
+	defaultSummaryMaxAge and defaultSummaryAgeBuckets valid values should be > 0
+	defaultMode valid values include - "pull" "push"
+	defaultRemoteWriteBatchSize and defaultRemoteWriteTimeout valid values should be > 0
+	defaultRemoteWriteRetries valid values should be >= 0
 */
 var defaultType = "all"
 var defaultMetricsCount = 1
@@ -48,6 +90,30 @@ var defaultDataPointCount = 1
 var defaultFreq = 15
 var defaultRand = false
 var defaultAddress = "0.0.0.0:8080"
+var defaultOpenMetrics = false
+var defaultExpositionFormat = "auto"
+var defaultCreatedSeries = false
+var defaultExemplars = false
+var defaultTracing = false
+var defaultHistogramMode = "classic"
+var defaultNativeHistogramBucketFactor = 1.1
+var defaultNativeHistogramMaxBucketNumber = 160
+var defaultNativeHistogramZeroThreshold = 0.0
+var defaultHistogramBucketGenerator = "explicit"
+var defaultHistogramBuckets = []float64{0.1, 0.5, 1}
+var defaultHistogramBucketStart = 0.1
+var defaultHistogramBucketWidth = 0.1
+var defaultHistogramBucketFactor = 2.0
+var defaultHistogramBucketCount = 10
+var defaultSummaryObjectives = map[float64]float64{0.1: 0.5, 0.5: 0.5, 0.99: 0.5}
+var defaultSummaryMaxAge = 600
+var defaultSummaryAgeBuckets = 5
+var defaultMode = "pull"
+var defaultRemoteWriteURL = ""
+var defaultRemoteWriteBatchSize = 500
+var defaultRemoteWriteRetries = 3
+var defaultRemoteWriteTimeout = 10
+var defaultRemoteWriteSigV4Region = ""
 
 type CommandLine struct{}
 
@@ -64,10 +130,75 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 func (conf *Config) initConnection() {
 
 	rand.Seed(time.Now().Unix())
+	if _, ok := expositionFormats[conf.ExpositionFormat]; !ok {
+		log.Fatal("Invalid exposition format")
+	}
+	// Forcing the OpenMetrics format requires it to be enabled
+	if conf.ExpositionFormat == "openmetrics" {
+		conf.OpenMetrics = true
+	}
+	// Exemplars reference the traces of the metric updates, which only exist with tracing
+	if conf.Exemplars && !conf.Tracing {
+		log.Fatal("Exemplars require tracing")
+	}
+	if conf.Tracing {
+		shutdown, err := startTracing(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				log.Println(err)
+			}
+		}()
+		log.Println("Tracing metric updates over OTLP")
+	}
 	mc := newMetricCollector()
 	mc.interval = time.Duration(conf.Frequency) * time.Second
 	mc.labelValues, mc.labelKeys = generateLabels(conf.LabelsCount)
 	mc.datapointCount = conf.DataPointCount
+	mc.exemplars = conf.Exemplars
+	mc.openMetrics = conf.OpenMetrics
+	switch conf.HistogramMode {
+	case "classic", "native", "both":
+	default:
+		log.Fatal("Invalid histogram mode")
+	}
+	if conf.HistogramMode != "classic" && conf.NativeHistogramBucketFactor <= 1 {
+		log.Fatal("Native histogram bucket factor must be greater than 1")
+	}
+	if conf.NativeHistogramMaxBucketNumber < 0 || conf.NativeHistogramZeroThreshold < 0 {
+		log.Fatal("Native histogram max bucket number and zero threshold must not be negative")
+	}
+	switch conf.Mode {
+	case "pull":
+	case "push":
+		if conf.RemoteWriteURL == "" {
+			log.Fatal("Remote write URL is required in push mode")
+		}
+		if conf.RemoteWriteBatchSize <= 0 || conf.RemoteWriteTimeout <= 0 || conf.RemoteWriteRetries < 0 {
+			log.Fatal("Remote write batch size and timeout must be positive, retries must not be negative")
+		}
+	default:
+		log.Fatal("Invalid mode")
+	}
+	buckets, err := conf.histogramBuckets()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := conf.validateSummary(); err != nil {
+		log.Fatal(err)
+	}
+	mc.histogramBuckets = buckets
+	mc.summaryObjectives = conf.SummaryObjectives
+	mc.summaryMaxAge = time.Duration(conf.SummaryMaxAge) * time.Second
+	mc.summaryAgeBuckets = uint32(conf.SummaryAgeBuckets)
+	mc.histogramMode = conf.HistogramMode
+	mc.nativeBucketFactor = conf.NativeHistogramBucketFactor
+	mc.nativeMaxBucketNumber = uint32(conf.NativeHistogramMaxBucketNumber)
+	mc.nativeZeroThreshold = conf.NativeHistogramZeroThreshold
 	switch conf.Type {
 	case "counter":
 		createCounter(conf.MetricsCount, mc)
@@ -105,9 +236,22 @@ func (conf *Config) initConnection() {
 	}()
 	log.Println("Updating at a frequency of "+fmt.Sprintf("%d", mc.interval/time.Second), "seconds")
 	http.HandleFunc("/", healthCheckHandler)
-	http.Handle("/metrics", promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}))
+	http.Handle("/metrics", metricsHandler(conf))
+
+	// In push mode the metrics are also sent with remote write, at the frequency they are updated
+	pushCtx, stopPush := context.WithCancel(context.Background())
+	defer stopPush()
+	if conf.Mode == "push" {
+		rw, err := conf.remoteWriter(pushCtx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go rw.pushLoop(pushCtx, mc.interval)
+		log.Println("Pushing metrics with remote write to " + conf.RemoteWriteURL)
+	}
 
 	<-done
+	stopPush()
 	log.Print("Server Stopped")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer func() {
@@ -206,6 +350,30 @@ func (cli *CommandLine) Run() {
 	usedFreq := defaultFreq
 	usedRand := defaultRand
 	usedAddress := defaultAddress
+	usedOpenMetrics := defaultOpenMetrics
+	usedExpositionFormat := defaultExpositionFormat
+	usedCreatedSeries := defaultCreatedSeries
+	usedExemplars := defaultExemplars
+	usedTracing := defaultTracing
+	usedHistogramMode := defaultHistogramMode
+	usedNativeHistogramBucketFactor := defaultNativeHistogramBucketFactor
+	usedNativeHistogramMaxBucketNumber := defaultNativeHistogramMaxBucketNumber
+	usedNativeHistogramZeroThreshold := defaultNativeHistogramZeroThreshold
+	usedHistogramBucketGenerator := defaultHistogramBucketGenerator
+	usedHistogramBuckets := floatList(defaultHistogramBuckets)
+	usedHistogramBucketStart := defaultHistogramBucketStart
+	usedHistogramBucketWidth := defaultHistogramBucketWidth
+	usedHistogramBucketFactor := defaultHistogramBucketFactor
+	usedHistogramBucketCount := defaultHistogramBucketCount
+	usedSummaryObjectives := objectives(defaultSummaryObjectives)
+	usedSummaryMaxAge := defaultSummaryMaxAge
+	usedSummaryAgeBuckets := defaultSummaryAgeBuckets
+	usedMode := defaultMode
+	usedRemoteWriteURL := defaultRemoteWriteURL
+	usedRemoteWriteBatchSize := defaultRemoteWriteBatchSize
+	usedRemoteWriteRetries := defaultRemoteWriteRetries
+	usedRemoteWriteTimeout := defaultRemoteWriteTimeout
+	usedRemoteWriteSigV4Region := defaultRemoteWriteSigV4Region
 	if conf.Type != "" {
 		usedType = conf.Type
 	}
@@ -227,6 +395,78 @@ func (cli *CommandLine) Run() {
 	if conf.Address != "" {
 		usedAddress = conf.Address
 	}
+	if conf.OpenMetrics {
+		usedOpenMetrics = conf.OpenMetrics
+	}
+	if conf.ExpositionFormat != "" {
+		usedExpositionFormat = conf.ExpositionFormat
+	}
+	if conf.CreatedSeries {
+		usedCreatedSeries = conf.CreatedSeries
+	}
+	if conf.Exemplars {
+		usedExemplars = conf.Exemplars
+	}
+	if conf.Tracing {
+		usedTracing = conf.Tracing
+	}
+	if conf.HistogramMode != "" {
+		usedHistogramMode = conf.HistogramMode
+	}
+	if conf.NativeHistogramBucketFactor > 0 {
+		usedNativeHistogramBucketFactor = conf.NativeHistogramBucketFactor
+	}
+	if conf.NativeHistogramMaxBucketNumber > 0 {
+		usedNativeHistogramMaxBucketNumber = conf.NativeHistogramMaxBucketNumber
+	}
+	if conf.NativeHistogramZeroThreshold > 0 {
+		usedNativeHistogramZeroThreshold = conf.NativeHistogramZeroThreshold
+	}
+	if conf.HistogramBucketGenerator != "" {
+		usedHistogramBucketGenerator = conf.HistogramBucketGenerator
+	}
+	if len(conf.HistogramBuckets) > 0 {
+		usedHistogramBuckets = conf.HistogramBuckets
+	}
+	if conf.HistogramBucketStart != 0 {
+		usedHistogramBucketStart = conf.HistogramBucketStart
+	}
+	if conf.HistogramBucketWidth > 0 {
+		usedHistogramBucketWidth = conf.HistogramBucketWidth
+	}
+	if conf.HistogramBucketFactor > 0 {
+		usedHistogramBucketFactor = conf.HistogramBucketFactor
+	}
+	if conf.HistogramBucketCount > 0 {
+		usedHistogramBucketCount = conf.HistogramBucketCount
+	}
+	if len(conf.SummaryObjectives) > 0 {
+		usedSummaryObjectives = conf.SummaryObjectives
+	}
+	if conf.SummaryMaxAge > 0 {
+		usedSummaryMaxAge = conf.SummaryMaxAge
+	}
+	if conf.SummaryAgeBuckets > 0 {
+		usedSummaryAgeBuckets = conf.SummaryAgeBuckets
+	}
+	if conf.Mode != "" {
+		usedMode = conf.Mode
+	}
+	if conf.RemoteWriteURL != "" {
+		usedRemoteWriteURL = conf.RemoteWriteURL
+	}
+	if conf.RemoteWriteBatchSize > 0 {
+		usedRemoteWriteBatchSize = conf.RemoteWriteBatchSize
+	}
+	if conf.RemoteWriteRetries > 0 {
+		usedRemoteWriteRetries = conf.RemoteWriteRetries
+	}
+	if conf.RemoteWriteTimeout > 0 {
+		usedRemoteWriteTimeout = conf.RemoteWriteTimeout
+	}
+	if conf.RemoteWriteSigV4Region != "" {
+		usedRemoteWriteSigV4Region = conf.RemoteWriteSigV4Region
+	}
 
 	metricType := generateCmd.String("metric_type", usedType, "Type of metric (counter, gauge, histogram, summary)")
 	metricCount := generateCmd.Int("metric_count", usedMetricsCount, "Amount of metrics to create")
@@ -235,6 +475,30 @@ func (cli *CommandLine) Run() {
 	metricFreq := generateCmd.Int("metric_frequency", usedFreq, "Refresh interval in seconds")
 	addressPtr := generateCmd.String("listen_address", usedAddress, "server listening address")
 	rand := generateCmd.Bool("is_random", usedRand, "Metrics specification")
+	openMetrics := generateCmd.Bool("open_metrics", usedOpenMetrics, "Negotiate the OpenMetrics exposition format")
+	expositionFormat := generateCmd.String("exposition_format", usedExpositionFormat, "Format served at /metrics (auto, text, openmetrics, protobuf)")
+	createdSeries := generateCmd.Bool("created_series", usedCreatedSeries, "Expose _created series in the OpenMetrics format")
+	exemplars := generateCmd.Bool("exemplars", usedExemplars, "Attach exemplars to counter and histogram observations")
+	tracing := generateCmd.Bool("tracing", usedTracing, "Trace metric updates over OTLP, the trace IDs are used by exemplars")
+	histogramMode := generateCmd.String("histogram_mode", usedHistogramMode, "Histogram buckets (classic, native, both)")
+	nativeHistogramBucketFactor := generateCmd.Float64("native_histogram_bucket_factor", usedNativeHistogramBucketFactor, "Maximum growth factor between native histogram buckets")
+	nativeHistogramMaxBucketNumber := generateCmd.Int("native_histogram_max_bucket_number", usedNativeHistogramMaxBucketNumber, "Maximum number of native histogram buckets, 0 for no limit")
+	nativeHistogramZeroThreshold := generateCmd.Float64("native_histogram_zero_threshold", usedNativeHistogramZeroThreshold, "Width of the native histogram zero bucket, 0 for the client library default")
+	histogramBucketGenerator := generateCmd.String("histogram_bucket_generator", usedHistogramBucketGenerator, "Classic histogram buckets (explicit, linear, exponential)")
+	generateCmd.Var(&usedHistogramBuckets, "histogram_buckets", "Comma separated upper bounds of the explicit histogram buckets")
+	histogramBucketStart := generateCmd.Float64("histogram_bucket_start", usedHistogramBucketStart, "Upper bound of the first linear or exponential histogram bucket")
+	histogramBucketWidth := generateCmd.Float64("histogram_bucket_width", usedHistogramBucketWidth, "Width of the linear histogram buckets")
+	histogramBucketFactor := generateCmd.Float64("histogram_bucket_factor", usedHistogramBucketFactor, "Growth factor of the exponential histogram buckets")
+	histogramBucketCount := generateCmd.Int("histogram_bucket_count", usedHistogramBucketCount, "Number of linear or exponential histogram buckets")
+	generateCmd.Var(&usedSummaryObjectives, "summary_objectives", "Comma separated quantile:error objectives of the summaries")
+	summaryMaxAge := generateCmd.Int("summary_max_age", usedSummaryMaxAge, "Duration in seconds for which an observation stays relevant for the summary quantiles")
+	summaryAgeBuckets := generateCmd.Int("summary_age_buckets", usedSummaryAgeBuckets, "Number of buckets used to exclude observations older than the summary max age")
+	mode := generateCmd.String("mode", usedMode, "Expose the metrics to be scraped (pull) or also send them with remote write (push)")
+	remoteWriteURL := generateCmd.String("remote_write_url", usedRemoteWriteURL, "Remote write endpoint of push mode")
+	remoteWriteBatchSize := generateCmd.Int("remote_write_batch_size", usedRemoteWriteBatchSize, "Maximum number of series per remote write request")
+	remoteWriteRetries := generateCmd.Int("remote_write_retries", usedRemoteWriteRetries, "Number of retries of a failed remote write request")
+	remoteWriteTimeout := generateCmd.Int("remote_write_timeout", usedRemoteWriteTimeout, "Timeout of a remote write request in seconds")
+	remoteWriteSigV4Region := generateCmd.String("remote_write_sigv4_region", usedRemoteWriteSigV4Region, "Sign remote write requests with SigV4 for the aps service of this region")
 
 	if len(os.Args) > 1 {
 		err := generateCmd.Parse(os.Args[1:])
@@ -250,6 +514,30 @@ func (cli *CommandLine) Run() {
 	conf.Frequency = *metricFreq
 	conf.Random = *rand
 	conf.Address = *addressPtr
+	conf.OpenMetrics = *openMetrics
+	conf.ExpositionFormat = *expositionFormat
+	conf.CreatedSeries = *createdSeries
+	conf.Exemplars = *exemplars
+	conf.Tracing = *tracing
+	conf.HistogramMode = *histogramMode
+	conf.NativeHistogramBucketFactor = *nativeHistogramBucketFactor
+	conf.NativeHistogramMaxBucketNumber = *nativeHistogramMaxBucketNumber
+	conf.NativeHistogramZeroThreshold = *nativeHistogramZeroThreshold
+	conf.HistogramBucketGenerator = *histogramBucketGenerator
+	conf.HistogramBuckets = usedHistogramBuckets
+	conf.HistogramBucketStart = *histogramBucketStart
+	conf.HistogramBucketWidth = *histogramBucketWidth
+	conf.HistogramBucketFactor = *histogramBucketFactor
+	conf.HistogramBucketCount = *histogramBucketCount
+	conf.SummaryObjectives = usedSummaryObjectives
+	conf.SummaryMaxAge = *summaryMaxAge
+	conf.SummaryAgeBuckets = *summaryAgeBuckets
+	conf.Mode = *mode
+	conf.RemoteWriteURL = *remoteWriteURL
+	conf.RemoteWriteBatchSize = *remoteWriteBatchSize
+	conf.RemoteWriteRetries = *remoteWriteRetries
+	conf.RemoteWriteTimeout = *remoteWriteTimeout
+	conf.RemoteWriteSigV4Region = *remoteWriteSigV4Region
 
 	conf.initConnection()
 
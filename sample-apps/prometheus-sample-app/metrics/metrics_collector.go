@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -18,6 +19,17 @@ type metricCollector struct {
 	labelValues    []string
 	labelKeys      []string
 	interval       time.Duration
+	exemplars      bool
+	openMetrics    bool
+
+	histogramBuckets      []float64
+	summaryObjectives     map[float64]float64
+	summaryMaxAge         time.Duration
+	summaryAgeBuckets     uint32
+	histogramMode         string
+	nativeBucketFactor    float64
+	nativeMaxBucketNumber uint32
+	nativeZeroThreshold   float64
 }
 
 var (
@@ -29,11 +41,18 @@ func newMetricCollector() metricCollector {
 }
 
 // Periodically record metric values and labels for counter metric.
+// With exemplars enabled, each increment carries the trace context of the update when it is sampled.
 func (mc *metricCollector) updateCounter() {
+	ctx, span := tracer.Start(context.Background(), "update-counters")
+	defer span.End()
 	for _, c := range mc.counters {
 		for i := 0; i < mc.datapointCount; i++ {
 			labels := datapointLabels(i, mc.labelKeys, mc.labelValues)
-			c.With(labels).Add(rand.Float64())
+			if exemplar := exemplarLabels(ctx); mc.exemplars && exemplar != nil {
+				c.With(labels).(prometheus.ExemplarAdder).AddWithExemplar(rand.Float64(), exemplar)
+			} else {
+				c.With(labels).Add(rand.Float64())
+			}
 		}
 	}
 }
@@ -49,13 +68,20 @@ func (mc *metricCollector) updateGauge() {
 }
 
 // Periodically record metric values and labels for histogram metric.
+// With exemplars enabled, each observation carries the trace context of the update when it is sampled.
 func (mc *metricCollector) updateHistogram() {
+	ctx, span := tracer.Start(context.Background(), "update-histograms")
+	defer span.End()
 	for idx := 0; idx < len(mc.histograms); idx++ {
 		for i := 0; i < mc.datapointCount; i++ {
 			labels := datapointLabels(i, mc.labelKeys, mc.labelValues)
 			// generate fictional values for histogram with random normal distribution
 			v := (rand.NormFloat64() * *normDomain) + *normMean
-			mc.histograms[idx].With(labels).Observe(v)
+			if exemplar := exemplarLabels(ctx); mc.exemplars && exemplar != nil {
+				mc.histograms[idx].With(labels).(prometheus.ExemplarObserver).ObserveWithExemplar(v, exemplar)
+			} else {
+				mc.histograms[idx].With(labels).Observe(v)
+			}
 		}
 	}
 }
@@ -101,13 +127,18 @@ func (mc *metricCollector) updateMetrics() {
 }
 
 // Register the counter and label keys with Prometheus's default registry.
+// OpenMetrics requires counter names to end with _total, otherwise they are exposed with the unknown type.
 func (mc *metricCollector) registerCounter(count int) {
 	for idx := 0; idx < count; idx++ {
 		namespace := "test"
+		name := fmt.Sprintf("counter%v", idx)
+		if mc.openMetrics {
+			name += "_total"
+		}
 		counter := prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
-				Name:      fmt.Sprintf("counter%v", idx),
+				Name:      name,
 				Help:      "This is my counter",
 			},
 			append([]string{"datapoint_id"}, mc.labelKeys...))
@@ -133,16 +164,25 @@ func (mc *metricCollector) registerGauge(count int) {
 }
 
 // Register the histogram and label keys with Prometheus's default registry.
+// Native histograms are only exposed in the protobuf format, when the scraper negotiates it.
 func (mc *metricCollector) registerHistogram(count int) {
 	for idx := 0; idx < count; idx++ {
 		namespace := "test"
+		opts := prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      fmt.Sprintf("histogram%v", idx),
+			Help:      "This is my histogram",
+		}
+		if mc.histogramMode != "native" {
+			opts.Buckets = mc.histogramBuckets
+		}
+		if mc.histogramMode != "classic" {
+			opts.NativeHistogramBucketFactor = mc.nativeBucketFactor
+			opts.NativeHistogramMaxBucketNumber = mc.nativeMaxBucketNumber
+			opts.NativeHistogramZeroThreshold = mc.nativeZeroThreshold
+		}
 		histogram := prometheus.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Namespace: namespace,
-				Name:      fmt.Sprintf("histogram%v", idx),
-				Help:      "This is my histogram",
-				Buckets:   []float64{0.1, 0.5, 1},
-			},
+			opts,
 			append([]string{"datapoint_id"}, mc.labelKeys...))
 		promRegistry.MustRegister(histogram)
 		mc.histograms = append(mc.histograms, histogram)
@@ -155,14 +195,12 @@ func (mc *metricCollector) registerSummary(count int) {
 		namespace := "test"
 		summary := prometheus.NewSummaryVec(
 			prometheus.SummaryOpts{
-				Namespace: namespace,
-				Name:      fmt.Sprintf("summary%v", idx),
-				Help:      "This is my summary",
-				Objectives: map[float64]float64{
-					0.1:  0.5,
-					0.5:  0.5,
-					0.99: 0.5,
-				},
+				Namespace:  namespace,
+				Name:       fmt.Sprintf("summary%v", idx),
+				Help:       "This is my summary",
+				Objectives: mc.summaryObjectives,
+				MaxAge:     mc.summaryMaxAge,
+				AgeBuckets: mc.summaryAgeBuckets,
 			},
 			append([]string{"datapoint_id"}, mc.labelKeys...))
 		promRegistry.MustRegister(summary)
@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Metric types of the remote write MetricMetadata message.
+var remoteWriteMetricTypes = map[dto.MetricType]prompb.MetricMetadata_MetricType{
+	dto.MetricType_UNTYPED:         prompb.MetricMetadata_UNKNOWN,
+	dto.MetricType_COUNTER:         prompb.MetricMetadata_COUNTER,
+	dto.MetricType_GAUGE:           prompb.MetricMetadata_GAUGE,
+	dto.MetricType_HISTOGRAM:       prompb.MetricMetadata_HISTOGRAM,
+	dto.MetricType_GAUGE_HISTOGRAM: prompb.MetricMetadata_GAUGEHISTOGRAM,
+	dto.MetricType_SUMMARY:         prompb.MetricMetadata_SUMMARY,
+}
+
+// requestHook modifies a remote write request before it is sent, e.g. to add authentication headers.
+// body is the snappy compressed payload of the request.
+type requestHook func(req *http.Request, body []byte) error
+
+// headersHook returns a requestHook setting the given headers.
+func headersHook(headers map[string]string) requestHook {
+	return func(req *http.Request, body []byte) error {
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return nil
+	}
+}
+
+// series is a time series of the metric family at index family of the gathered families.
+type series struct {
+	prompb.TimeSeries
+	family int
+}
+
+// remoteWriter sends the contents of promRegistry with the Prometheus remote write 1.0 protocol.
+type remoteWriter struct {
+	url       string
+	batchSize int
+	retries   int
+	client    http.Client
+	hooks     []requestHook
+}
+
+// remoteWriter returns the remoteWriter of push mode. The RemoteWriteHeaders are set on every request, which is then
+// signed with SigV4 when RemoteWriteSigV4Region is set.
+func (conf *Config) remoteWriter(ctx context.Context) (*remoteWriter, error) {
+	rw := &remoteWriter{
+		url:       conf.RemoteWriteURL,
+		batchSize: conf.RemoteWriteBatchSize,
+		retries:   conf.RemoteWriteRetries,
+		client:    http.Client{Timeout: time.Duration(conf.RemoteWriteTimeout) * time.Second},
+	}
+	if len(conf.RemoteWriteHeaders) > 0 {
+		rw.hooks = append(rw.hooks, headersHook(conf.RemoteWriteHeaders))
+	}
+	if conf.RemoteWriteSigV4Region != "" {
+		hook, err := sigv4Hook(ctx, conf.RemoteWriteSigV4Region, "aps")
+		if err != nil {
+			return nil, err
+		}
+		rw.hooks = append(rw.hooks, hook)
+	}
+	return rw, nil
+}
+
+// push gathers promRegistry and sends its samples to the remote write URL, in requests of at most batchSize series.
+func (rw *remoteWriter) push(ctx context.Context) error {
+	families, err := promRegistry.Gather()
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().UnixMilli()
+	var all []series
+	for i, mf := range families {
+		all = append(all, familySeries(i, mf, timestamp)...)
+	}
+	for start := 0; start < len(all); start += rw.batchSize {
+		end := start + rw.batchSize
+		if end > len(all) {
+			end = len(all)
+		}
+		data, err := writeRequest(families, all[start:end]).Marshal()
+		if err != nil {
+			return err
+		}
+		if err := rw.send(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send posts a WriteRequest, retrying with an exponential backoff when the request fails or the receiver
+// responds with a 5xx or 429 status. Other error statuses mean the data is rejected and are not retried.
+func (rw *remoteWriter) send(ctx context.Context, writeRequest []byte) error {
+	body := snappy.Encode(nil, writeRequest)
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, err := rw.attempt(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= rw.retries {
+			return err
+		}
+		log.Printf("Remote write failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt posts body once and reports whether a failure can be retried.
+func (rw *remoteWriter) attempt(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "prometheus-sample-app")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for _, hook := range rw.hooks {
+		if err := hook(req, body); err != nil {
+			return false, err
+		}
+	}
+	res, err := rw.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 256))
+	err = fmt.Errorf("remote write to %s: %s: %s", rw.url, res.Status, bytes.TrimSpace(msg))
+	return res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests, err
+}
+
+// pushLoop pushes promRegistry every interval until ctx is done.
+func (rw *remoteWriter) pushLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := rw.push(ctx); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+	}
+}
+
+// familySeries returns the series of a metric family as they would be scraped, each with a sample at timestamp: histograms and
+// summaries are split into their _bucket or quantile, _sum and _count series. Native histograms are only sent as their classic buckets, if any.
+func familySeries(family int, mf *dto.MetricFamily, timestamp int64) []series {
+	var all []series
+	add := func(m *dto.Metric, name string, value float64, exemplar *dto.Exemplar, extra ...prompb.Label) {
+		labels := []prompb.Label{{Name: "__name__", Value: name}}
+		for _, lp := range m.GetLabel() {
+			labels = append(labels, prompb.Label{Name: lp.GetName(), Value: lp.GetValue()})
+		}
+		labels = append(labels, extra...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		s := series{family: family}
+		s.Labels = labels
+		s.Samples = []prompb.Sample{{Value: value, Timestamp: timestamp}}
+		if exemplar != nil {
+			s.Exemplars = []prompb.Exemplar{remoteWriteExemplar(exemplar, timestamp)}
+		}
+		all = append(all, s)
+	}
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			add(m, name, m.GetCounter().GetValue(), m.GetCounter().GetExemplar())
+		case dto.MetricType_GAUGE:
+			add(m, name, m.GetGauge().GetValue(), nil)
+		case dto.MetricType_UNTYPED:
+			add(m, name, m.GetUntyped().GetValue(), nil)
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			for _, q := range s.GetQuantile() {
+				add(m, name, q.GetValue(), nil, prompb.Label{Name: "quantile", Value: formatFloat(q.GetQuantile())})
+			}
+			add(m, name+"_sum", s.GetSampleSum(), nil)
+			add(m, name+"_count", float64(s.GetSampleCount()), nil)
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			h := m.GetHistogram()
+			for _, b := range h.GetBucket() {
+				if math.IsInf(b.GetUpperBound(), 1) {
+					continue
+				}
+				add(m, name+"_bucket", float64(b.GetCumulativeCount()), b.GetExemplar(), prompb.Label{Name: "le", Value: formatFloat(b.GetUpperBound())})
+			}
+			add(m, name+"_bucket", float64(h.GetSampleCount()), nil, prompb.Label{Name: "le", Value: "+Inf"})
+			add(m, name+"_sum", h.GetSampleSum(), nil)
+			add(m, name+"_count", float64(h.GetSampleCount()), nil)
+		}
+	}
+	return all
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// remoteWriteExemplar converts an exemplar, using timestamp when it has none.
+func remoteWriteExemplar(e *dto.Exemplar, timestamp int64) prompb.Exemplar {
+	exemplar := prompb.Exemplar{Value: e.GetValue(), Timestamp: timestamp}
+	for _, lp := range e.GetLabel() {
+		exemplar.Labels = append(exemplar.Labels, prompb.Label{Name: lp.GetName(), Value: lp.GetValue()})
+	}
+	if e.GetTimestamp() != nil {
+		exemplar.Timestamp = e.GetTimestamp().AsTime().UnixMilli()
+	}
+	return exemplar
+}
+
+// writeRequest returns a WriteRequest holding batch and the metadata of the metric families of its series.
+func writeRequest(families []*dto.MetricFamily, batch []series) *prompb.WriteRequest {
+	wr := &prompb.WriteRequest{}
+	included := map[int]bool{}
+	for _, s := range batch {
+		wr.Timeseries = append(wr.Timeseries, s.TimeSeries)
+		included[s.family] = true
+	}
+	for i, mf := range families {
+		if !included[i] {
+			continue
+		}
+		wr.Metadata = append(wr.Metadata, prompb.MetricMetadata{
+			Type:             remoteWriteMetricTypes[mf.GetType()],
+			MetricFamilyName: mf.GetName(),
+			Help:             mf.GetHelp(),
+		})
+	}
+	return wr
+}
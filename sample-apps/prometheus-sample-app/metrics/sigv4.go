@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// sigv4Hook returns a requestHook signing remote write requests with AWS Signature Version 4 for service in region,
+// e.g. "aps" for Amazon Managed Service for Prometheus. The credentials come from the default AWS credential chain:
+// environment variables, shared config and credentials files, then the IAM role of the task or instance.
+func sigv4Hook(ctx context.Context, region, service string) (requestHook, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	signer := v4.NewSigner()
+	return func(req *http.Request, body []byte) error {
+		creds, err := cfg.Credentials.Retrieve(req.Context())
+		if err != nil {
+			return err
+		}
+		payloadHash := sha256.Sum256(body)
+		return signer.SignHTTP(req.Context(), creds, req, hex.EncodeToString(payloadHash[:]), service, region, time.Now())
+	}, nil
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces the metric updates when tracing is enabled, and is a no-op otherwise.
+var tracer = otel.Tracer("github.com/open-o11y/prometheus-sample-app/metrics")
+
+// startTracing sets up a tracer provider exporting spans over OTLP/gRPC, configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+// The returned function flushes the buffered spans and stops the provider.
+func startTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("prometheus-sample-app"),
+	))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// exemplarLabels returns the trace and span IDs of the span in ctx as exemplar labels, or nil when there is no
+// sampled span, so exemplars never reference a trace that is not exported.
+func exemplarLabels(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()}
+}